@@ -4,8 +4,8 @@ Copyright © 2024 Silicon Labs
 package cmd
 
 import (
+	"context"
 	"fmt"
-	"runtime"
 	"silabs/get-zap/gh"
 	"silabs/get-zap/jf"
 
@@ -24,41 +24,100 @@ var fetchCmd = &cobra.Command{
 	
 Note: command line arguments can modify this flow.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		Fetch(ReadGithubConfiguration(), ReadArtifactoryConfiguration(), viper.GetBool(useGh), viper.GetBool(useRt))
+		Fetch(cmd.Context(), ReadGithubConfiguration(), ReadArtifactoryConfiguration(), viper.GetBool(useGh), viper.GetBool(useRt))
 	},
 }
 
 // This is what gets executed if no toplevel commands are passed.
-func Fetch(ghCfg *gh.GithubConfiguration, rtCfg *jf.ArtifactoryConfiguration, useGh bool, useRt bool) {
+func Fetch(ctx context.Context, ghCfg *gh.GithubConfiguration, rtCfg *jf.ArtifactoryConfiguration, useGh bool, useRt bool) {
 	if !useGh && !useRt {
 		fmt.Println("Neither Artifactory nor Github are enabled, nothing to do.")
-	} else if !useGh {
+		return
+	}
+
+	// The Github client is only created when Github is used, and then only once, so that its warnings are printed once.
+	var client *gh.GithubClient
+	githubClient := func() *gh.GithubClient {
+		if client == nil {
+			client = gh.CreateGithubClient(ghCfg)
+		}
+		return client
+	}
+
+	if ghCfg.NeedsResolution() {
+		// Ranges and channels are resolved to a concrete tag first, so that the tag can be used as the Artifactory cache key.
+		if !useGh {
+			fmt.Printf("Release '%v' can only be resolved using Github. When using --useGh=false, please specify a specific release.\n", ghCfg.Release)
+			return
+		}
+		tag := gh.ResolveReleaseTag(ctx, githubClient(), ghCfg)
+		if tag == "" {
+			cobra.CheckErr(fmt.Errorf("could not find a release matching '%v'", ghCfg.Release))
+		}
+		fmt.Printf("Resolved '%v' to release '%v'.\n", ghCfg.Release, tag)
+		ghCfg.Release = tag
+	}
+
+	if ghCfg.DryRun {
+		// A dry run only shows which assets would be selected on Github, it doesn't touch Artifactory.
+		if useGh {
+			gh.DownloadAssets(ctx, githubClient(), ghCfg, ".")
+		} else {
+			fmt.Printf("A dry run shows the assets that would be selected on Github, it can not be used with --useGh=false.\n")
+		}
+		return
+	}
+
+	if !useGh {
 		// We only check artifactory, if we don't find it, we're done.
 		if ghCfg.Release == "latest" || ghCfg.Release == "all" {
 			fmt.Printf("Artifactory does not cache 'latest' or 'all' releases. When using --useGh=false, please specify a specific release.\n")
+		} else if ghCfg.Asset != "local" {
+			fmt.Printf("Artifactory only caches assets selected by platform. When using --useGh=false, please use --ghAsset local.\n")
 		} else {
-			jf.ArtifactoryDownload(rtCfg, jf.ArtifactoryPattern(ghCfg.Release, true))
+			for _, platform := range ghCfg.Platforms {
+				jf.ArtifactoryDownloadCached(rtCfg, jf.ArtifactoryCachePath(ghCfg.Release, platform.Dir()), ghCfg.Release)
+			}
+			cobra.CheckErr(gh.VerifyPinnedChecksums(ghCfg, ghCfg.Release, ghCfg.Release))
+			cobra.CheckErr(gh.VerifySignatures(ghCfg, ghCfg.Release))
+			cobra.CheckErr(gh.VerifyProvenance(ghCfg, ghCfg.Release))
 		}
 	} else if !useRt {
 		// We only attempt to download from github, if we don't find it, we're done.
-		fmt.Printf("Downloading release '%v' of repo '%v/%v' for the platform '%v/%v'...\n", ghCfg.Release, ghCfg.Owner, ghCfg.Repo, runtime.GOOS, runtime.GOARCH)
-		gh.DownloadAssets(ghCfg, ".", true, ".zip")
+		fmt.Printf("Downloading release '%v' of repo '%v/%v' for the platforms %v...\n", ghCfg.Release, ghCfg.Owner, ghCfg.Repo, ghCfg.Platforms)
+		gh.DownloadAssets(ctx, githubClient(), ghCfg, ".")
 	} else {
 		// If we get here, we're going to do the following: first we attempt to download the assset from artifactory. If we can't find it, we will download it
 		// from github. If we do find it, we will then upload it to artifactory for the next time someone tries to download this same thing.
+		// Assets are cached separately for each platform.
 		if ghCfg.Release == "latest" || ghCfg.Release == "all" {
 			fmt.Printf("Artifactory does not cache 'latest' or 'all' releases. Downloading from github.\n")
-			gh.DownloadAssets(ghCfg, ".", true, ".zip")
+			gh.DownloadAssets(ctx, githubClient(), ghCfg, ".")
+		} else if ghCfg.Asset != "local" {
+			fmt.Printf("Artifactory only caches assets selected by platform. Downloading from github.\n")
+			gh.DownloadAssets(ctx, githubClient(), ghCfg, ".")
 		} else {
-			success := jf.ArtifactoryDownload(rtCfg, jf.ArtifactoryPattern(ghCfg.Release, true))
-			if success > 0 {
-				fmt.Printf("Asset was retrieved from Artifactory.\n")
-			} else {
-				// Didn't find it in artifactory, let's go to github.
-				fmt.Printf("Asset not found in Artifactory, trying github.\n")
-				gh.DownloadAssets(ghCfg, ".", true, ".zip")
-				fmt.Printf("Uploading assets to Artifactory for caching.\n")
-				jf.ArtifactoryUpload(rtCfg, jf.ArtifactoryPattern(ghCfg.Release, true))
+			for _, platform := range ghCfg.Platforms {
+				// Artifactory transfers can't be interrupted, so stop between platforms after Ctrl-C.
+				cobra.CheckErr(ctx.Err())
+				cachePath := jf.ArtifactoryCachePath(ghCfg.Release, platform.Dir())
+				success := jf.ArtifactoryDownloadCached(rtCfg, cachePath, ghCfg.Release)
+				if success > 0 {
+					// Artifactory verifies its own checksums while downloading, we check the ones from the config file,
+					// and the signatures and provenance that were cached together with the assets.
+					cobra.CheckErr(gh.VerifyPinnedChecksums(ghCfg, ghCfg.Release, ghCfg.Release))
+					cobra.CheckErr(gh.VerifySignatures(ghCfg, ghCfg.Release))
+					cobra.CheckErr(gh.VerifyProvenance(ghCfg, ghCfg.Release))
+					fmt.Printf("Assets for platform '%v' were retrieved from Artifactory.\n", platform)
+				} else {
+					// Didn't find it in artifactory, let's go to github.
+					fmt.Printf("Assets for platform '%v' not found in Artifactory, trying github.\n", platform)
+					platformCfg := *ghCfg
+					platformCfg.Platforms = []gh.Platform{platform}
+					files := gh.DownloadAssets(ctx, githubClient(), &platformCfg, ".")
+					fmt.Printf("Uploading assets to Artifactory for caching.\n")
+					jf.ArtifactoryUploadCached(rtCfg, files, cachePath)
+				}
 			}
 		}
 	}
@@ -17,10 +17,16 @@ var listCmd = &cobra.Command{
 Without any additional arguments, it will print all available releases for a given repo.
 When specified with the --release tag, it will print the available assets for that release.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		gh.ListGithub(ReadGithubConfiguration())
+		limit, err := cmd.Flags().GetInt("limit")
+		cobra.CheckErr(err)
+		pageSize, err := cmd.Flags().GetInt("page-size")
+		cobra.CheckErr(err)
+		gh.ListGithub(cmd.Context(), ReadGithubConfiguration(), limit, pageSize)
 	},
 }
 
 func init() {
 	ghCmd.AddCommand(listCmd)
+	listCmd.Flags().Int("limit", 0, "Maximum number of releases to list when listing all releases, 0 for no limit.")
+	listCmd.Flags().Int("page-size", gh.MaxPageSize, "Number of releases requested from Github per API call.")
 }
@@ -0,0 +1,26 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package cmd
+
+import (
+	"silabs/get-zap/gh"
+
+	"github.com/spf13/cobra"
+)
+
+var ghPlatformsCmd = &cobra.Command{
+	Use:   "platforms",
+	Short: "Shows how the assets of a release are classified by platform.",
+	Long: `This command prints the OS, architecture, C library and variant that the platform
+detection rules determine for each asset of a release, and whether the asset matches the local platform.
+
+Built-in rules can be overridden in the configuration file, with a list of rules under the "platforms" key.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		gh.ListPlatforms(cmd.Context(), ReadGithubConfiguration())
+	},
+}
+
+func init() {
+	ghCmd.AddCommand(ghPlatformsCmd)
+}
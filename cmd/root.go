@@ -4,10 +4,17 @@ Copyright © 2024 Silicon Labs
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"silabs/get-zap/gh"
 	"silabs/get-zap/jf"
+	"silabs/get-zap/progress"
+	"silabs/get-zap/throttle"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -19,6 +26,54 @@ const repoArg = "ghRepo"
 const githubTokenArg = "ghToken"
 const releaseArg = "ghRelease"
 const assetArg = "ghAsset"
+const excludeArg = "exclude"
+const osArg = "os"
+const archArg = "arch"
+const platformArg = "platform"
+const preferFormatArg = "preferFormat"
+const preferVariantArg = "preferVariant"
+const preferSizeArg = "preferSize"
+const dryRunArg = "dry-run"
+const lastArg = "last"
+const parallelArg = "parallel"
+const retriesArg = "retries"
+const retryDelayArg = "retryDelay"
+const waitForRateLimitArg = "waitForRateLimit"
+const cacheDirArg = "cacheDir"
+const cacheTtlArg = "cacheTtl"
+const offlineArg = "offline"
+const versionRangeArg = "versionRange"
+const channelArg = "channel"
+const channelsKey = "channels"
+const platformsKey = "platforms"
+const platformFallbacksKey = "platformFallbacks"
+const checksumsKey = "checksums"
+const signingKeysKey = "signingKeys"
+const requireSignatureArg = "requireSignature"
+const verifyProvenanceArg = "verifyProvenance"
+const provenanceKey = "provenance"
+const releasedBeforeArg = "releasedBefore"
+const releasedAfterArg = "releasedAfter"
+const proxyArg = "proxy"
+const proxyUserArg = "proxyUser"
+const proxyPasswordArg = "proxyPassword"
+const noProxyArg = "noProxy"
+const proxiesKey = "proxies"
+const debugArg = "debug"
+const maxSizeArg = "maxSize"
+const caBundleArg = "caBundle"
+const ghCaBundleArg = "ghCaBundle"
+const ghClientCertArg = "ghClientCert"
+const ghClientKeyArg = "ghClientKey"
+const rtCaBundleArg = "rtCaBundle"
+const rtClientCertArg = "rtClientCert"
+const rtClientKeyArg = "rtClientKey"
+const insecureSkipVerifyArg = "insecureSkipVerify"
+const allowHttpArg = "allowHttp"
+const noProgressArg = "noProgress"
+const progressArg = "progress"
+const limitRateArg = "limitRate"
+const limitRatePerTransferArg = "limitRatePerTransfer"
 const rtUrl = "rtUrl"
 const rtApiKey = "rtApiKey"
 const rtUser = "rtUser"
@@ -35,34 +90,172 @@ var rootCmd = &cobra.Command{
 	Short: "Application to retrieve artifacts from github.",
 	Long:  `This application by default retrieves zap artifacts, with the right arguments, it can be used to retrieve assets from any public github repo.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		Fetch(ReadGithubConfiguration(), ReadArtifactoryConfiguration(), viper.GetBool(useGh), viper.GetBool(useRt))
+		Fetch(cmd.Context(), ReadGithubConfiguration(), ReadArtifactoryConfiguration(), viper.GetBool(useGh), viper.GetBool(useRt))
 	},
 }
 
 func ReadArtifactoryConfiguration() *jf.ArtifactoryConfiguration {
-	return &jf.ArtifactoryConfiguration{
+	cfg := &jf.ArtifactoryConfiguration{
 		Url:    viper.GetString(rtUrl),
 		ApiKey: viper.GetString(rtApiKey),
 		User:   viper.GetString(rtUser),
 		Repo:   viper.GetString(rtRepo),
 		Path:   viper.GetString(rtPath),
+
+		CaBundles:          nonEmpty(viper.GetString(caBundleArg), viper.GetString(rtCaBundleArg)),
+		ClientCert:         viper.GetString(rtClientCertArg),
+		ClientKey:          viper.GetString(rtClientKeyArg),
+		InsecureSkipVerify: viper.GetBool(insecureSkipVerifyArg),
+		Debug:              viper.GetBool(debugArg),
+		Progress:           ReadProgressReporter(),
+		Limiter:            ReadLimiter(),
+	}
+	// The JFrog client already uses the proxy environment variables, so its proxy is only replaced for other settings.
+	if dso := ReadDownloadOptions(); dso.HasProxySettings() {
+		cfg.Proxy = dso.ProxyFunc()
+	}
+	return cfg
+}
+
+// Returns the values that are not empty.
+func nonEmpty(values ...string) []string {
+	var result []string
+	for _, value := range values {
+		if value != "" {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+var progressReporter *progress.Reporter
+
+// Returns the progress reporter, which is shared by the transfers from Github and Artifactory.
+func ReadProgressReporter() *progress.Reporter {
+	if progressReporter == nil {
+		mode := viper.GetString(progressArg)
+		if viper.GetBool(noProgressArg) {
+			mode = progress.None
+		}
+		reporter, err := progress.New(mode)
+		cobra.CheckErr(err)
+		progressReporter = reporter
+	}
+	return progressReporter
+}
+
+var limiter *throttle.Limiter
+
+// Returns the limiter of the download rate, which is shared by the downloads from Github and Artifactory.
+func ReadLimiter() *throttle.Limiter {
+	if limiter == nil {
+		rate, err := gh.ParseSize(viper.GetString(limitRateArg))
+		cobra.CheckErr(err)
+		limiter = throttle.New(rate, !viper.GetBool(limitRatePerTransferArg))
+	}
+	return limiter
+}
+
+// Reads the proxy, TLS and progress settings of connections to Github.
+func ReadDownloadOptions() *gh.DownloadOptions {
+	sec := gh.DefaultSecurityOptions()
+	if proxy := viper.GetString(proxyArg); proxy != "" {
+		cobra.CheckErr(sec.SetProxy(proxy))
+	}
+	// Proxy rules are a list of { "host": ..., "proxy": ... } objects in the config file.
+	var proxyRules []gh.ProxyRule
+	cobra.CheckErr(viper.UnmarshalKey(proxiesKey, &proxyRules))
+	cobra.CheckErr(sec.SetProxyRules(proxyRules))
+	sec.SetNoProxy(viper.GetString(noProxyArg))
+	sec.SetProxyCredentials(viper.GetString(proxyUserArg), viper.GetString(proxyPasswordArg))
+	sec.SetDebug(viper.GetBool(debugArg))
+	maxSize, err := gh.ParseSize(viper.GetString(maxSizeArg))
+	cobra.CheckErr(err)
+	sec.SetMaxSize(maxSize)
+	sec.AddCaBundle(viper.GetString(caBundleArg))
+	sec.AddCaBundle(viper.GetString(ghCaBundleArg))
+	if cert := viper.GetString(ghClientCertArg); cert != "" {
+		sec.SetClientCertificate(cert, viper.GetString(ghClientKeyArg))
 	}
+	sec.SetSkipCertCheck(viper.GetBool(insecureSkipVerifyArg))
+	sec.SetAllowHttp(viper.GetBool(allowHttpArg))
+	sec.SetShowPercentage(!viper.GetBool(noProgressArg))
+	sec.SetProgress(ReadProgressReporter())
+	sec.SetLimiter(ReadLimiter())
+	return sec
 }
 
 func ReadGithubConfiguration() *gh.GithubConfiguration {
-	return &gh.GithubConfiguration{
+	cfg := &gh.GithubConfiguration{
 		Owner:   viper.GetString(ownerArg),
 		Repo:    viper.GetString(repoArg),
 		Token:   viper.GetString(githubTokenArg),
 		Release: viper.GetString(releaseArg),
 		Asset:   viper.GetString(assetArg),
+		Exclude: viper.GetStringSlice(excludeArg),
+		Channel: viper.GetString(channelArg),
+		Preference: gh.AssetPreference{
+			Formats: viper.GetStringSlice(preferFormatArg),
+			Variant: viper.GetString(preferVariantArg),
+			Size:    viper.GetString(preferSizeArg),
+		},
+		DryRun:       viper.GetBool(dryRunArg),
+		Last:         viper.GetInt(lastArg),
+		VersionRange: viper.GetString(versionRangeArg),
+		Parallel:     viper.GetInt(parallelArg),
+		Retry: gh.RetryPolicy{
+			Retries:  viper.GetInt(retriesArg),
+			Delay:    viper.GetDuration(retryDelayArg),
+			MaxDelay: gh.DefaultMaxRetryDelay,
+		},
+		WaitForRateLimit: viper.GetBool(waitForRateLimitArg),
+		CacheDirectory:   viper.GetString(cacheDirArg),
+		CacheTtl:         viper.GetDuration(cacheTtlArg),
+		Offline:          viper.GetBool(offlineArg),
+		RequireSignature: viper.GetBool(requireSignatureArg),
+		VerifyProvenance: viper.GetBool(verifyProvenanceArg),
+		Download:         ReadDownloadOptions(),
 	}
+	// Channel rules are configured per repo in the config file, e.g. "channels": { "project-chip/zap": { "stable": { ... } } }
+	var channels map[string]map[string]gh.ChannelRule
+	cobra.CheckErr(viper.UnmarshalKey(channelsKey, &channels))
+	cfg.ChannelRules = channels[strings.ToLower(cfg.Owner+"/"+cfg.Repo)]
+	// Signing keys are configured per repo as well, e.g. "signingKeys": { "project-chip/zap": [ { "type": "minisign", "key": "RWQ..." } ] }
+	var signingKeys map[string][]gh.SigningKey
+	cobra.CheckErr(viper.UnmarshalKey(signingKeysKey, &signingKeys))
+	cfg.SigningKeys = signingKeys[strings.ToLower(cfg.Owner+"/"+cfg.Repo)]
+	// So is the provenance policy, e.g. "provenance": { "project-chip/zap": { "builderId": "...", "sourceRepository": "..." } }
+	var provenance map[string]gh.ProvenancePolicy
+	cobra.CheckErr(viper.UnmarshalKey(provenanceKey, &provenance))
+	cfg.ProvenancePolicy = provenance[strings.ToLower(cfg.Owner+"/"+cfg.Repo)]
+	// Platform detection rules are a list of { "field": ..., "pattern": ..., "value": ... } objects in the config file.
+	cobra.CheckErr(viper.UnmarshalKey(platformsKey, &cfg.PlatformRules))
+	// Fallbacks are configured per OS and architecture, e.g. "platformFallbacks": { "linux": { "arm64": [ "amd64" ] } }
+	cobra.CheckErr(viper.UnmarshalKey(platformFallbacksKey, &cfg.PlatformFallbacks))
+	// Checksums are a list of { "release": ..., "asset": ..., "sha256": ... } objects in the config file.
+	cobra.CheckErr(viper.UnmarshalKey(checksumsKey, &cfg.Checksums))
+	var err error
+	cfg.Platforms, err = gh.TargetPlatforms(viper.GetString(osArg), viper.GetString(archArg), viper.GetStringSlice(platformArg))
+	cobra.CheckErr(err)
+	cfg.ReleasedBefore, err = gh.ParseReleaseDate(viper.GetString(releasedBeforeArg))
+	cobra.CheckErr(err)
+	cfg.ReleasedAfter, err = gh.ParseReleaseDate(viper.GetString(releasedAfterArg))
+	cobra.CheckErr(err)
+	return cfg
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Ctrl-C and SIGTERM cancel the context of the command, which stops transfers in flight and
+// removes their temporary files. A second signal terminates immediately.
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
 		os.Exit(1)
 	}
@@ -75,9 +268,50 @@ func init() {
 	rootCmd.PersistentFlags().String(ownerArg, "project-chip", "Owner of the github repository.")
 	rootCmd.PersistentFlags().String(repoArg, "zap", "Name of the github repository.")
 	rootCmd.PersistentFlags().StringP(githubTokenArg, "t", "", "Github token to use for authentication.")
-	rootCmd.PersistentFlags().StringP(releaseArg, "r", "latest", "Release to download. Specify a name, or 'all' or 'latest' for all releases.")
+	rootCmd.PersistentFlags().StringP(releaseArg, "r", "latest", "Release to download. Specify a name, a version constraint such as '>=v2024.03.14', '~v2024.04' or '^1.2', or 'all' or 'latest' for all releases.")
+	rootCmd.PersistentFlags().Int(lastArg, 0, "With '--ghRelease all', only use this many of the newest releases.")
+	rootCmd.PersistentFlags().String(versionRangeArg, "", "With '--ghRelease all', only use releases matching this version constraint, e.g. '>=v2024.01.01'.")
+	rootCmd.PersistentFlags().String(channelArg, "", "Release channel to pick 'latest' or version constraints from: stable, nightly, prerelease, any, or a channel from the config file. By default, Github's latest release is used.")
+	rootCmd.PersistentFlags().String(releasedBeforeArg, "", "Only consider releases published before this date (YYYY-MM-DD or RFC 3339), e.g. to get the release that was latest on a given day.")
+	rootCmd.PersistentFlags().String(releasedAfterArg, "", "Only consider releases published at or after this date (YYYY-MM-DD or RFC 3339).")
 	rootCmd.PersistentFlags().String(localRoot, ".", "Local root directory to download assets to. All operations are limited to within this directory.")
-	rootCmd.PersistentFlags().StringP(assetArg, "a", "local", "Asset to download. Specify a name, or 'all' or 'local' for matching the platform.")
+	rootCmd.PersistentFlags().StringP(assetArg, "a", "local", "Asset to download. Specify an exact name, a glob such as '*.tar.gz', a regular expression prefixed with 're:', or 'all' or 'local' for matching the platform.")
+	rootCmd.PersistentFlags().String(osArg, "", "Target OS to select assets for, instead of the local one, e.g. 'windows'.")
+	rootCmd.PersistentFlags().String(archArg, "", "Target architecture to select assets for, instead of the local one, e.g. 'arm64'.")
+	rootCmd.PersistentFlags().StringArray(platformArg, []string{}, "Target platform to select assets for, as os/arch, e.g. 'darwin/arm64'. Can be repeated to download assets for several platforms.")
+	rootCmd.PersistentFlags().StringSlice(preferFormatArg, gh.DefaultFormats, "Asset formats in order of preference, used to pick one asset per platform.")
+	rootCmd.PersistentFlags().String(preferVariantArg, "", "Preferred asset variant, e.g. 'cli' for zap-cli. By default, assets without a variant are preferred.")
+	rootCmd.PersistentFlags().String(preferSizeArg, "", "Use 'largest' or 'smallest' to pick between otherwise equal assets by size.")
+	rootCmd.PersistentFlags().Bool(dryRunArg, false, "Show which assets would be downloaded, and how they were ranked, without downloading anything.")
+	rootCmd.PersistentFlags().Int(parallelArg, 1, "Number of assets to download at the same time.")
+	rootCmd.PersistentFlags().Int(retriesArg, 3, "Number of times a failed Github request or asset download is retried, if the failure is transient.")
+	rootCmd.PersistentFlags().Duration(retryDelayArg, time.Second, "Delay before the first retry. It doubles with every further retry, up to 30s.")
+	rootCmd.PersistentFlags().Bool(waitForRateLimitArg, false, "When the Github API rate limit is exhausted, wait for it to reset instead of failing.")
+	rootCmd.PersistentFlags().String(cacheDirArg, gh.DefaultCacheDirectory(), "Directory to cache Github API responses in. Use an empty value to disable the cache.")
+	rootCmd.PersistentFlags().Duration(cacheTtlArg, 5*time.Minute, "How long cached Github API responses are used before they are revalidated with Github.")
+	rootCmd.PersistentFlags().Bool(offlineArg, false, "Only use cached Github API responses and files that are already downloaded, never contact Github.")
+	rootCmd.PersistentFlags().Bool(requireSignatureArg, false, "Fail unless every asset has a valid signature by one of the signing keys configured for the repo.")
+	rootCmd.PersistentFlags().Bool(verifyProvenanceArg, false, "Verify the assets against the SLSA provenance (*.intoto.jsonl) published with the release, and the provenance policy configured for the repo.")
+	rootCmd.PersistentFlags().StringArray(excludeArg, []string{}, "Asset name, glob or 're:' regular expression to skip. Can be repeated.")
+	rootCmd.PersistentFlags().String(proxyArg, "", "Proxy URL for Github and Artifactory, e.g. 'http://proxy.example.com:8080'. By default, HTTPS_PROXY and HTTP_PROXY are used.")
+	rootCmd.PersistentFlags().String(noProxyArg, "", "Comma separated hosts and domains to connect to without a proxy, like NO_PROXY. By default, NO_PROXY is used.")
+	rootCmd.PersistentFlags().String(proxyUserArg, "", "User for proxies that require authentication, if the proxy URL has none.")
+	rootCmd.PersistentFlags().String(proxyPasswordArg, "", "Password of --proxyUser. Prefer the GET_ZAP_PROXYPASSWORD environment variable.")
+	rootCmd.PersistentFlags().Bool(debugArg, false, "Print debug output, such as the proxy used for each request.")
+	rootCmd.PersistentFlags().String(caBundleArg, "", "PEM file with CA certificates to trust besides the system ones, for Github and Artifactory.")
+	rootCmd.PersistentFlags().String(ghCaBundleArg, "", "PEM file with CA certificates to trust for Github only, e.g. of a TLS-intercepting proxy.")
+	rootCmd.PersistentFlags().String(ghClientCertArg, "", "PEM file with the client certificate for Github connections that require mutual TLS.")
+	rootCmd.PersistentFlags().String(ghClientKeyArg, "", "PEM file with the key of --ghClientCert, if it is not in the certificate file.")
+	rootCmd.PersistentFlags().String(rtCaBundleArg, "", "PEM file with CA certificates to trust for Artifactory only.")
+	rootCmd.PersistentFlags().String(rtClientCertArg, "", "PEM file with the client certificate for an Artifactory that requires mutual TLS.")
+	rootCmd.PersistentFlags().String(rtClientKeyArg, "", "PEM file with the key of --rtClientCert, if it is not in the certificate file.")
+	rootCmd.PersistentFlags().Bool(insecureSkipVerifyArg, false, "Don't verify TLS certificates of Github and Artifactory. Prefer --caBundle.")
+	rootCmd.PersistentFlags().Bool(allowHttpArg, false, "Allow asset downloads over unencrypted HTTP.")
+	rootCmd.PersistentFlags().String(maxSizeArg, gh.DefaultMaxSize, "Maximum size of a downloaded asset, e.g. '500MB' or '2GiB'. 0 disables the limit.")
+	rootCmd.PersistentFlags().String(limitRateArg, "0", "Maximum rate of all downloads together in bytes per second, e.g. '5M' or '500KB'. 0 disables the limit.")
+	rootCmd.PersistentFlags().Bool(limitRatePerTransferArg, false, "Apply --limitRate to each download on its own, so that e.g. --parallel 4 may use four times the rate.")
+	rootCmd.PersistentFlags().Bool(noProgressArg, false, "Don't print the download progress of assets, same as --progress none.")
+	rootCmd.PersistentFlags().String(progressArg, progress.Auto, "How the progress of transfers is shown: "+strings.Join(progress.Modes, ", ")+". 'auto' shows bars on a terminal and periodic lines otherwise, 'json' writes events to stderr.")
 	rootCmd.PersistentFlags().String(rtUrl, "", "Artifactory URL.")
 	rootCmd.PersistentFlags().String(rtApiKey, "", "Artifactory API Key.")
 	rootCmd.PersistentFlags().String(rtUser, "", "Artifactory user.")
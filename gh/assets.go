@@ -0,0 +1,165 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Compiles an asset name pattern. Patterns prefixed with 're:' are regular expressions,
+// patterns containing '*', '?' or '[' are globs, everything else is an exact asset name.
+func compileAssetPattern(pattern string) (func(string) bool, error) {
+	if strings.HasPrefix(pattern, "re:") {
+		re, err := regexp.Compile(strings.TrimPrefix(pattern, "re:"))
+		if err != nil {
+			return nil, fmt.Errorf("invalid asset regular expression '%v': %v", pattern, err)
+		}
+		return re.MatchString, nil
+	}
+	if strings.ContainsAny(pattern, "*?[") {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid asset glob '%v': %v", pattern, err)
+		}
+		return func(name string) bool {
+			matched, _ := path.Match(pattern, name)
+			return matched
+		}, nil
+	}
+	return func(name string) bool { return name == pattern }, nil
+}
+
+// Returns the assets that match the --ghAsset pattern and are not excluded by --exclude.
+// Excluded assets are reported once, not for every target platform.
+func filterAssets(cfg *GithubConfiguration, assets []*github.ReleaseAsset) ([]*github.ReleaseAsset, error) {
+	include := func(string) bool { return true }
+	if cfg.Asset != "" && cfg.Asset != "all" && cfg.Asset != "local" {
+		var err error
+		if include, err = compileAssetPattern(cfg.Asset); err != nil {
+			return nil, err
+		}
+	}
+	var excludes []func(string) bool
+	for _, pattern := range cfg.Exclude {
+		exclude, err := compileAssetPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+		excludes = append(excludes, exclude)
+	}
+	var candidates []*github.ReleaseAsset
+	for _, asset := range assets {
+		name := asset.GetName()
+		if !include(name) {
+			continue
+		}
+		if isExcluded(name, excludes) {
+			fmt.Printf("Skipping asset '%v' as it is excluded.\n", name)
+			continue
+		}
+		candidates = append(candidates, asset)
+	}
+	return candidates, nil
+}
+
+// Selects the assets to download from the candidates returned by filterAssets. With 'local',
+// candidates are matched against the target platform. Returns an error listing all assets
+// of the release if nothing matches.
+func selectAssets(cfg *GithubConfiguration, release *github.RepositoryRelease, assets []*github.ReleaseAsset, candidates []*github.ReleaseAsset, target Platform) ([]*github.ReleaseAsset, error) {
+	pc, err := NewPlatformClassifier(cfg.PlatformRules)
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []*github.ReleaseAsset
+	// Platform independent assets alone don't count as a match, if the release has platform specific ones.
+	hasPlatformAssets := false
+	matchedPlatformAssets := false
+	for _, asset := range candidates {
+		name := asset.GetName()
+		if cfg.Asset == "local" {
+			p := pc.DetermineAssetPlatform(name)
+			hasPlatformAssets = hasPlatformAssets || p.OS != ""
+			if !p.Matches(target) {
+				fmt.Printf("Skipping asset '%v' [os='%v', arch='%v'] as it does not match the platform '%v'.\n", name, p.OS, p.Arch, target)
+				continue
+			}
+			matchedPlatformAssets = matchedPlatformAssets || p.OS != ""
+		}
+		selected = append(selected, asset)
+	}
+
+	if len(selected) == 0 || (hasPlatformAssets && !matchedPlatformAssets) {
+		var available strings.Builder
+		for _, asset := range assets {
+			available.WriteString("\n  " + asset.GetName())
+		}
+		criteria := fmt.Sprintf("'%v'", cfg.Asset)
+		if cfg.Asset == "local" {
+			criteria += fmt.Sprintf(" for platform '%v'", target)
+		}
+		if len(cfg.Exclude) > 0 {
+			criteria += fmt.Sprintf(" excluding %v", strings.Join(cfg.Exclude, ", "))
+		}
+		return nil, fmt.Errorf("no asset of release '%v' matches %v. Available assets:%v", release.GetTagName(), criteria, available.String())
+	}
+	return selected, nil
+}
+
+func isExcluded(name string, excludes []func(string) bool) bool {
+	for _, exclude := range excludes {
+		if exclude(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Built-in fallback platforms, per OS and architecture, in order of preference. They are
+// used when a release has no asset for the native architecture, but the OS can run another
+// one, such as amd64 builds on arm64 macOS through Rosetta.
+var DefaultPlatformFallbacks = map[string]map[string][]string{
+	"darwin":  {"arm64": {"amd64"}},
+	"windows": {"arm64": {"amd64"}, "amd64": {"386"}},
+}
+
+// Returns the fallback architectures for a target platform. Fallbacks configured for the
+// OS and architecture take precedence over the built-in ones.
+func (cfg *GithubConfiguration) fallbackArchs(target Platform) []string {
+	if archs, ok := cfg.PlatformFallbacks[target.OS][target.Arch]; ok {
+		return archs
+	}
+	return DefaultPlatformFallbacks[target.OS][target.Arch]
+}
+
+// Selects the assets for a target platform like selectAssets. If the release has no asset for the
+// target platform, the fallback architectures are tried in order, with a warning when one is used.
+// With 'local', only the best asset according to the asset preferences is returned.
+func selectPlatformAssets(cfg *GithubConfiguration, release *github.RepositoryRelease, assets []*github.ReleaseAsset, candidates []*github.ReleaseAsset, target Platform) ([]*github.ReleaseAsset, error) {
+	if cfg.Asset != "local" {
+		return selectAssets(cfg, release, assets, candidates, target)
+	}
+	selected, err := selectAssets(cfg, release, assets, candidates, target)
+	if err == nil {
+		return pickAsset(cfg, target, selected)
+	}
+	var tried []string
+	for _, arch := range cfg.fallbackArchs(target) {
+		fallback := target
+		fallback.Arch = arch
+		tried = append(tried, fallback.String())
+		if selected, fallbackErr := selectAssets(cfg, release, assets, candidates, fallback); fallbackErr == nil {
+			fmt.Printf("Warning: release '%v' has no asset for platform '%v', using the assets for '%v' instead, which need emulation.\n", release.GetTagName(), target, fallback)
+			return pickAsset(cfg, fallback, selected)
+		}
+	}
+	if len(tried) > 0 {
+		return nil, fmt.Errorf("%v\nNo acceptable fallback either, tried: %v", err, strings.Join(tried, ", "))
+	}
+	return nil, err
+}
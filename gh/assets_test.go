@@ -0,0 +1,110 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/github"
+)
+
+func testAssets(names ...string) []*github.ReleaseAsset {
+	var assets []*github.ReleaseAsset
+	for _, name := range names {
+		assets = append(assets, &github.ReleaseAsset{Name: github.String(name)})
+	}
+	return assets
+}
+
+func assetNames(assets []*github.ReleaseAsset) string {
+	var names []string
+	for _, asset := range assets {
+		names = append(names, asset.GetName())
+	}
+	return strings.Join(names, " ")
+}
+
+// Returns what f prints on stdout.
+func captureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestFilterAssets(t *testing.T) {
+	assets := testAssets("zap-linux-x64.zip", "zap-linux-x64.deb", "zap-mac-x64.zip", "zap-win-x64.zip", "SHA256SUMS")
+	tests := []struct {
+		asset   string
+		exclude []string
+		want    string
+		wantErr bool
+	}{
+		{"local", nil, "zap-linux-x64.zip zap-linux-x64.deb zap-mac-x64.zip zap-win-x64.zip SHA256SUMS", false},
+		{"all", []string{"*.deb", "SHA256SUMS"}, "zap-linux-x64.zip zap-mac-x64.zip zap-win-x64.zip", false},
+		{"zap-*.zip", []string{"re:-win-"}, "zap-linux-x64.zip zap-mac-x64.zip", false},
+		{"zap-mac-x64.zip", nil, "zap-mac-x64.zip", false},
+		{"re:(", nil, "", true},
+		{"local", []string{"zap-[.zip"}, "", true},
+	}
+	for _, test := range tests {
+		cfg := &GithubConfiguration{Asset: test.asset, Exclude: test.exclude}
+		candidates, err := filterAssets(cfg, assets)
+		if (err != nil) != test.wantErr || assetNames(candidates) != test.want {
+			t.Errorf("filterAssets(%v excluding %v) = %v, %v, want %v", test.asset, test.exclude, assetNames(candidates), err, test.want)
+		}
+	}
+}
+
+func TestSelectPlatformAssetsExcludes(t *testing.T) {
+	assets := testAssets("zap-linux-x64.zip", "zap-linux-x64.deb", "zap-mac-x64.zip", "zap-win-x64.zip")
+	cfg := &GithubConfiguration{Asset: "local", Exclude: []string{"*.deb"}, PlatformFallbacks: map[string]map[string][]string{}}
+	release := &github.RepositoryRelease{TagName: github.String("v2024.04.15")}
+	targets := []Platform{{OS: "linux", Arch: "amd64"}, {OS: "darwin", Arch: "amd64"}, {OS: "windows", Arch: "amd64"}}
+	var selected []*github.ReleaseAsset
+	output := captureStdout(t, func() {
+		candidates, err := filterAssets(cfg, assets)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, target := range targets {
+			s, err := selectPlatformAssets(cfg, release, assets, candidates, target)
+			if err != nil {
+				t.Errorf("selectPlatformAssets(%v) error = %v", target, err)
+			}
+			selected = append(selected, s...)
+		}
+	})
+	if got := assetNames(selected); got != "zap-linux-x64.zip zap-mac-x64.zip zap-win-x64.zip" {
+		t.Errorf("selected %v", got)
+	}
+	if n := strings.Count(output, "Skipping asset 'zap-linux-x64.deb' as it is excluded."); n != 1 {
+		t.Errorf("the excluded asset was reported %v times, want once:\n%v", n, output)
+	}
+
+	// The error lists all assets of the release, including the excluded ones.
+	cfg.Exclude = []string{"zap-linux-*"}
+	captureStdout(t, func() {
+		candidates, _ := filterAssets(cfg, assets)
+		_, err := selectPlatformAssets(cfg, release, assets, candidates, targets[0])
+		if err == nil || !strings.Contains(err.Error(), "excluding zap-linux-*") || !strings.Contains(err.Error(), "\n  zap-linux-x64.deb") {
+			t.Errorf("selectPlatformAssets() error = %v", err)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Suffix of temporary files that downloads are written to before they are renamed into place.
+const TempSuffix = ".tmp"
+
+// Creates a hidden temporary file next to the final file name in the directory.
+func createTempFile(directory string, name string) (*os.File, error) {
+	return os.CreateTemp(directory, "."+name+".*"+TempSuffix)
+}
+
+// Flushes a completely written file to disk, closes it and renames it to path. Readers of
+// path either see the previous file or the complete new one, never a truncated one.
+func commitFile(file *os.File, path string) error {
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Closes and removes a temporary file that was not committed.
+func discardFile(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
+
+// Temporary files that were not written to for this long are left behind by a run that was killed.
+const staleTempFileAge = time.Hour
+
+// Removes temporary files of a file name, left behind by a run that was killed before it could clean up.
+// Recently written ones may belong to another process that downloads the same file into a shared
+// directory, so they are kept.
+func removeStaleTempFiles(directory string, name string) {
+	matches, _ := filepath.Glob(filepath.Join(directory, "."+name+".*"+TempSuffix))
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil && time.Since(info.ModTime()) > staleTempFileAge {
+			os.Remove(match)
+		}
+	}
+}
+
+// Writes data into a file, through a temporary file that is renamed into place.
+func writeFileAtomic(path string, data []byte) error {
+	file, err := createTempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		discardFile(file)
+		return err
+	}
+	if err := commitFile(file, path); err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+	return nil
+}
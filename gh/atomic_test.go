@@ -0,0 +1,46 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRemoveStaleTempFiles(t *testing.T) {
+	directory := t.TempDir()
+	stale, err := createTempFile(directory, "zap-linux-x64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.Close()
+	old := time.Now().Add(-2 * staleTempFileAge)
+	if err := os.Chtimes(stale.Name(), old, old); err != nil {
+		t.Fatal(err)
+	}
+	// Another process is still writing this one.
+	live, err := createTempFile(directory, "zap-linux-x64.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+	other := filepath.Join(directory, ".zap-mac-x64.zip.1234"+TempSuffix)
+	if err := os.WriteFile(other, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(other, old, old)
+
+	removeStaleTempFiles(directory, "zap-linux-x64.zip")
+	if _, err := os.Stat(stale.Name()); !os.IsNotExist(err) {
+		t.Errorf("stale temporary file was kept: %v", err)
+	}
+	if _, err := os.Stat(live.Name()); err != nil {
+		t.Errorf("live temporary file was removed: %v", err)
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("temporary file of another asset was removed: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Caches Github API responses on disk. Cached responses younger than the TTL are served
+// without asking Github. Older ones are revalidated with If-None-Match and If-Modified-Since,
+// and Github doesn't count a 304 Not Modified answer against the rate limit.
+type cacheTransport struct {
+	base http.RoundTripper
+	// Directory the responses are stored in.
+	directory string
+	// Distinguishes the responses seen with different tokens, as they may see different releases.
+	keyPrefix string
+	ttl       time.Duration
+	// If true, responses are only served from the cache, and Github is never asked.
+	offline bool
+}
+
+// Returns the directory that Github API responses are cached in.
+func DefaultCacheDirectory() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "get-zap", "github")
+}
+
+// Wraps the base transport with an on-disk cache, if a cache directory is configured.
+func newCacheTransport(base http.RoundTripper, cfg *GithubConfiguration) http.RoundTripper {
+	if cfg.CacheDirectory == "" {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	sum := sha256.Sum256([]byte(cfg.Token))
+	return &cacheTransport{base: base, directory: cfg.CacheDirectory, keyPrefix: hex.EncodeToString(sum[:]), ttl: cfg.CacheTtl, offline: cfg.Offline}
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Accept") == "application/octet-stream" {
+		// Only API responses are cached. Assets are large, and downloaded into files anyway.
+		if t.offline {
+			return nil, errors.New("nothing can be downloaded from Github in offline mode")
+		}
+		return t.base.RoundTrip(req)
+	}
+	path := t.path(req)
+	cached, stored := t.load(path, req)
+	if cached != nil && (t.offline || time.Since(stored) < t.ttl) {
+		// Rate limit headers of old responses are outdated, and would confuse the rate limit tracking.
+		removeRateHeaders(cached.Header)
+		return cached, nil
+	}
+	if t.offline {
+		return nil, errors.New("the response is not cached, and Github can't be asked in offline mode")
+	}
+
+	revalidation := req.Clone(req.Context())
+	if cached != nil {
+		if etag := cached.Header.Get("ETag"); etag != "" {
+			revalidation.Header.Set("If-None-Match", etag)
+		}
+		if modified := cached.Header.Get("Last-Modified"); modified != "" {
+			revalidation.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	resp, err := t.base.RoundTrip(revalidation)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		removeRateHeaders(cached.Header)
+		for name, values := range resp.Header {
+			if strings.HasPrefix(name, "X-Ratelimit-") {
+				cached.Header[name] = values
+			}
+		}
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return cached, nil
+	}
+	if resp.StatusCode == http.StatusOK {
+		// Failing to write the cache only costs us a request next time.
+		t.store(path, resp)
+	}
+	return resp, nil
+}
+
+// Returns the file that the response to a request is cached in.
+func (t *cacheTransport) path(req *http.Request) string {
+	sum := sha256.Sum256([]byte(t.keyPrefix + " " + req.Header.Get("Accept") + " " + req.URL.String()))
+	return filepath.Join(t.directory, hex.EncodeToString(sum[:]))
+}
+
+// Returns the cached response and when it was stored or last revalidated, or nil if there is none.
+func (t *cacheTransport) load(path string, req *http.Request) (*http.Response, time.Time) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(data)), req)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	return resp, info.ModTime()
+}
+
+// Writes a response into the cache. The body is read, and replaced with a copy.
+func (t *cacheTransport) store(path string, resp *http.Response) error {
+	data, err := httputil.DumpResponse(resp, true)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(t.directory, 0775); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func removeRateHeaders(header http.Header) {
+	for name := range header {
+		if strings.HasPrefix(name, "X-Ratelimit-") {
+			delete(header, name)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// A Github API stand-in, which answers revalidations of its ETag with 304 Not Modified.
+type apiServer struct {
+	*httptest.Server
+	requests atomic.Int32
+	// Conditional headers of the last request.
+	ifNoneMatch     string
+	ifModifiedSince string
+}
+
+const testETag = `"0123abcd"`
+const testLastModified = "Tue, 02 Apr 2024 09:15:00 GMT"
+
+func newApiServer(t *testing.T) *apiServer {
+	s := &apiServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		remaining := 60 - s.requests.Add(1)
+		s.ifNoneMatch = r.Header.Get("If-None-Match")
+		s.ifModifiedSince = r.Header.Get("If-Modified-Since")
+		w.Header().Set("X-RateLimit-Limit", "60")
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(remaining)))
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		if s.ifNoneMatch == testETag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", testLastModified)
+		w.Header().Set("X-Release-Count", "2")
+		io.WriteString(w, `[{"tag_name":"v2024.04.15"},{"tag_name":"v2024.03.14"}]`)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newTestCache(t *testing.T, server *apiServer, directory string, token string, ttl time.Duration, offline bool) http.RoundTripper {
+	cfg := &GithubConfiguration{CacheDirectory: directory, CacheTtl: ttl, Offline: offline, Token: token}
+	return newCacheTransport(server.Client().Transport, cfg)
+}
+
+// Makes a request through the transport, and returns its response with the body read.
+func cachedGet(t *testing.T, transport http.RoundTripper, url string, accept string) (*http.Response, string, error) {
+	req, _ := http.NewRequest(http.MethodGet, url, nil)
+	req.Header.Set("Accept", accept)
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, string(body), nil
+}
+
+const apiAccept = "application/vnd.github.v3+json"
+
+func TestCacheTtlHit(t *testing.T) {
+	server := newApiServer(t)
+	cache := newTestCache(t, server, t.TempDir(), "", time.Hour, false)
+	_, first, err := cachedGet(t, cache, server.URL+"/releases", apiAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, second, err := cachedGet(t, cache, server.URL+"/releases", apiAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.requests.Load() != 1 {
+		t.Errorf("Github got %v requests, want 1", server.requests.Load())
+	}
+	if first != second || resp.StatusCode != http.StatusOK || resp.Header.Get("X-Release-Count") != "2" {
+		t.Errorf("cached response = %v %v %v, want the first one", resp.StatusCode, resp.Header, second)
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "" {
+		t.Errorf("cached response has the outdated rate limit header %v", resp.Header.Get("X-RateLimit-Remaining"))
+	}
+}
+
+func TestCacheRevalidation(t *testing.T) {
+	server := newApiServer(t)
+	directory := t.TempDir()
+	cache := newTestCache(t, server, directory, "", time.Hour, false)
+	_, first, err := cachedGet(t, cache, server.URL+"/releases", apiAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Makes the cached response older than the TTL.
+	entries, _ := os.ReadDir(directory)
+	if len(entries) != 1 {
+		t.Fatalf("the cache has %v entries, want 1", len(entries))
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(filepath.Join(directory, entries[0].Name()), old, old)
+
+	resp, second, err := cachedGet(t, cache, server.URL+"/releases", apiAccept)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if server.ifNoneMatch != testETag || server.ifModifiedSince != testLastModified {
+		t.Errorf("revalidation sent If-None-Match '%v' and If-Modified-Since '%v'", server.ifNoneMatch, server.ifModifiedSince)
+	}
+	if resp.StatusCode != http.StatusOK || second != first || resp.Header.Get("ETag") != testETag || resp.Header.Get("X-Release-Count") != "2" {
+		t.Errorf("revalidated response = %v %v %v, want the cached one", resp.StatusCode, resp.Header, second)
+	}
+	// The rate limit comes from the 304, the one of the cached response is outdated.
+	if resp.Header.Get("X-RateLimit-Remaining") != "58" || resp.Header.Get("X-RateLimit-Limit") != "60" {
+		t.Errorf("revalidated response has rate limit headers %v", resp.Header)
+	}
+	// The revalidated response is fresh again.
+	if info, _ := os.Stat(filepath.Join(directory, entries[0].Name())); time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("the revalidated response is still from %v", info.ModTime())
+	}
+	cachedGet(t, cache, server.URL+"/releases", apiAccept)
+	if server.requests.Load() != 2 {
+		t.Errorf("Github got %v requests, want 2", server.requests.Load())
+	}
+}
+
+func TestCacheOffline(t *testing.T) {
+	server := newApiServer(t)
+	directory := t.TempDir()
+	online := newTestCache(t, server, directory, "", 0, false)
+	offline := newTestCache(t, server, directory, "", 0, true)
+	if _, _, err := cachedGet(t, offline, server.URL+"/releases", apiAccept); err == nil {
+		t.Error("offline cache miss succeeded")
+	}
+	if _, _, err := cachedGet(t, offline, server.URL+"/asset", "application/octet-stream"); err == nil {
+		t.Error("offline asset download succeeded")
+	}
+	if server.requests.Load() != 0 {
+		t.Fatalf("Github got %v requests in offline mode", server.requests.Load())
+	}
+	if _, _, err := cachedGet(t, online, server.URL+"/releases", apiAccept); err != nil {
+		t.Fatal(err)
+	}
+	// Offline, cached responses are used however old they are.
+	resp, body, err := cachedGet(t, offline, server.URL+"/releases", apiAccept)
+	if err != nil || resp.StatusCode != http.StatusOK || body == "" {
+		t.Errorf("offline cache hit = %v, %v", resp, err)
+	}
+	if server.requests.Load() != 1 {
+		t.Errorf("Github got %v requests, want 1", server.requests.Load())
+	}
+}
+
+func TestCacheBypass(t *testing.T) {
+	server := newApiServer(t)
+	directory := t.TempDir()
+	cache := newTestCache(t, server, directory, "", time.Hour, false)
+	for i := 0; i < 2; i++ {
+		if _, _, err := cachedGet(t, cache, server.URL+"/asset", "application/octet-stream"); err != nil {
+			t.Fatal(err)
+		}
+		cachedGet(t, cache, server.URL+"/missing", apiAccept)
+	}
+	if server.requests.Load() != 4 {
+		t.Errorf("Github got %v requests, want 4", server.requests.Load())
+	}
+	if entries, _ := os.ReadDir(directory); len(entries) != 0 {
+		t.Errorf("the cache has %v entries, want none for assets and errors", len(entries))
+	}
+}
+
+func TestCacheKeyByToken(t *testing.T) {
+	server := newApiServer(t)
+	directory := t.TempDir()
+	first := newTestCache(t, server, directory, "token-1", time.Hour, false)
+	second := newTestCache(t, server, directory, "token-2", time.Hour, false)
+	for _, cache := range []http.RoundTripper{first, second, first, second} {
+		if _, _, err := cachedGet(t, cache, server.URL+"/releases", apiAccept); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if server.requests.Load() != 2 {
+		t.Errorf("Github got %v requests, want one per token", server.requests.Load())
+	}
+	entries, _ := os.ReadDir(directory)
+	if len(entries) != 2 {
+		t.Fatalf("the cache has %v entries, want one per token", len(entries))
+	}
+	// The token itself is not written into the cache.
+	for _, entry := range entries {
+		data, _ := os.ReadFile(filepath.Join(directory, entry.Name()))
+		if strings.Contains(string(data)+entry.Name(), "token-") {
+			t.Errorf("the cache entry %v contains the token", entry.Name())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// ChannelRule describes which releases belong to a release channel.
+type ChannelRule struct {
+	// Regular expression that the tag must match. Empty matches every tag.
+	Include string `mapstructure:"include"`
+	// Regular expression that the tag must not match. Empty excludes nothing.
+	Exclude string `mapstructure:"exclude"`
+	// If set, the prerelease flag of the release must have this value.
+	Prerelease *bool `mapstructure:"prerelease"`
+	// Draft releases are only part of the channel if this is true.
+	Draft bool `mapstructure:"draft"`
+}
+
+var no = false
+var yes = true
+
+// Built-in channels. They can be overridden, or new ones added, per repo in the configuration file.
+var DefaultChannelRules = map[string]ChannelRule{
+	"stable":     {Exclude: `-nightly$`, Prerelease: &no},
+	"nightly":    {Include: `-nightly$`},
+	"prerelease": {Prerelease: &yes},
+	"any":        {},
+}
+
+// releaseFilter decides which releases are candidates when resolving or listing releases.
+type releaseFilter struct {
+	include    *regexp.Regexp
+	exclude    *regexp.Regexp
+	prerelease *bool
+	draft      bool
+	before     time.Time
+	after      time.Time
+}
+
+// Creates the release filter for the configured channel and publishing dates. Rules configured
+// for the repo take precedence over the built-in ones. An empty channel accepts all non-draft
+// releases, except for 'latest', where it mirrors Github's latest release and skips prereleases.
+func newReleaseFilter(cfg *GithubConfiguration) (*releaseFilter, error) {
+	channel := strings.ToLower(cfg.Channel)
+	rule, ok := cfg.ChannelRules[channel]
+	if !ok {
+		rule, ok = DefaultChannelRules[channel]
+	}
+	if channel == "" {
+		rule, ok = ChannelRule{}, true
+		if cfg.Release == "latest" {
+			rule.Prerelease = &no
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown release channel '%v'", cfg.Channel)
+	}
+	f := &releaseFilter{prerelease: rule.Prerelease, draft: rule.Draft, before: cfg.ReleasedBefore, after: cfg.ReleasedAfter}
+	var err error
+	if rule.Include != "" {
+		if f.include, err = regexp.Compile(rule.Include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern for channel '%v': %v", channel, err)
+		}
+	}
+	if rule.Exclude != "" {
+		if f.exclude, err = regexp.Compile(rule.Exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern for channel '%v': %v", channel, err)
+		}
+	}
+	return f, nil
+}
+
+func (f *releaseFilter) matches(release *github.RepositoryRelease) bool {
+	if release.GetDraft() && !f.draft {
+		return false
+	}
+	if f.prerelease != nil && release.GetPrerelease() != *f.prerelease {
+		return false
+	}
+	if !f.before.IsZero() && !release.GetPublishedAt().Before(f.before) {
+		return false
+	}
+	if !f.after.IsZero() && release.GetPublishedAt().Before(f.after) {
+		return false
+	}
+	if f.include != nil && !f.include.MatchString(release.GetTagName()) {
+		return false
+	}
+	if f.exclude != nil && f.exclude.MatchString(release.GetTagName()) {
+		return false
+	}
+	return true
+}
+
+// Parses a date given to --releasedBefore or --releasedAfter. Accepts either a plain date,
+// which stands for midnight UTC, or an RFC 3339 timestamp.
+func ParseReleaseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%v', use YYYY-MM-DD or an RFC 3339 timestamp", s)
+	}
+	return t, nil
+}
+
+// Returns the releases that pass the filter.
+func (f *releaseFilter) apply(releases []*github.RepositoryRelease) []*github.RepositoryRelease {
+	var matching []*github.RepositoryRelease
+	for _, release := range releases {
+		if f.matches(release) {
+			matching = append(matching, release)
+		}
+	}
+	return matching
+}
@@ -0,0 +1,244 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// Maximum size of a checksum file that is read into memory.
+const maxChecksumFileSize = 1 << 20
+
+// ChecksumPin is a SHA-256 checksum of an asset that is configured in the config file,
+// e.g. "checksums": [ { "release": "v2024.03.14", "asset": "zap-linux-x64.zip", "sha256": "..." } ].
+// Without a release, the checksum applies to the asset of every release.
+type ChecksumPin struct {
+	Release string `mapstructure:"release"`
+	Asset   string `mapstructure:"asset"`
+	Sha256  string `mapstructure:"sha256"`
+}
+
+// What a downloaded asset is verified against.
+type expectedChecksum struct {
+	// Size of the asset, as reported by Github. Not checked if negative.
+	size int64
+	// Hex encoded SHA-256 of the asset, empty if no checksum is known.
+	sha256 string
+	// Where the SHA-256 comes from, for messages.
+	source string
+	// True if the SHA-256 comes from a checksum file with a valid signature.
+	signed bool
+	// If not nil, checks the signature of the downloaded file before it is renamed into place.
+	verifySignature func(path string) error
+}
+
+// A small file that is written into the release directory next to the assets.
+type releaseFile struct {
+	name string
+	data []byte
+}
+
+// Returns true if the asset contains checksums of other assets, such as SHA256SUMS or zap-linux-x64.zip.sha256.
+// Signatures of checksum files, such as SHA256SUMS.asc, are not checksum files themselves.
+func isChecksumAsset(name string) bool {
+	if signedAssetName(name) != "" {
+		return false
+	}
+	lower := strings.ToLower(name)
+	return strings.Contains(lower, "sha256sums") || strings.HasSuffix(lower, ".sha256") || strings.HasSuffix(lower, "checksums.txt")
+}
+
+// Parses the output of sha256sum: lines of a hex checksum, followed by the file name, optionally
+// prefixed with '*' for binary mode. A checksum without a file name is returned for the empty name.
+func parseChecksums(data []byte) map[string]string {
+	checksums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+			continue
+		}
+		if _, err := hex.DecodeString(fields[0]); err != nil {
+			continue
+		}
+		name := ""
+		if len(fields) > 1 {
+			name = filepath.Base(strings.TrimPrefix(strings.Join(fields[1:], " "), "*"))
+		}
+		checksums[name] = strings.ToLower(fields[0])
+	}
+	return checksums
+}
+
+// Returns the checksum of each asset of a release, from the checksums pinned in the config file
+// and from checksum assets of the release. Checksum assets are only fetched if there are any.
+// If a checksum asset is signed, its signature is checked, and the checksum asset and its
+// signature are returned as files to keep next to the assets. In offline mode, the copies kept
+// in the release directory are read instead, and checksum assets without a copy are skipped.
+func (d *downloader) releaseChecksums(ctx context.Context, release *github.RepositoryRelease, assets []*github.ReleaseAsset, releaseDirectory string) (map[string]expectedChecksum, []releaseFile, error) {
+	checksums := map[string]expectedChecksum{}
+	signatures := signatureAssets(assets)
+	var signedFiles []releaseFile
+	for _, asset := range assets {
+		if !isChecksumAsset(asset.GetName()) {
+			continue
+		}
+		data, found, err := d.read(ctx, asset, releaseDirectory)
+		if err != nil {
+			return nil, nil, fmt.Errorf("could not read checksums from '%v': %v", asset.GetName(), err)
+		}
+		if !found {
+			fmt.Printf("Skipping checksums of '%v' in offline mode, as no copy of it was kept.\n", asset.GetName())
+			continue
+		}
+		signed := false
+		if signatureAsset := signatures[asset.GetName()]; signatureAsset != nil && d.verifier.canVerify(signatureAsset.GetName()) {
+			signature, found, err := d.read(ctx, signatureAsset, releaseDirectory)
+			if err != nil {
+				return nil, nil, fmt.Errorf("could not read signature '%v': %v", signatureAsset.GetName(), err)
+			}
+			if !found {
+				return nil, nil, fmt.Errorf("no copy of the signature '%v' was kept, it can't be checked in offline mode", signatureAsset.GetName())
+			}
+			if err := d.verifier.verify(signatureAsset.GetName(), signature, bytes.NewReader(data)); err != nil {
+				return nil, nil, fmt.Errorf("%v: %v", asset.GetName(), err)
+			}
+			fmt.Printf("Verified signature of '%v'.\n", asset.GetName())
+			signed = true
+			signedFiles = append(signedFiles, releaseFile{asset.GetName(), data}, releaseFile{signatureAsset.GetName(), signature})
+		}
+		for name, sum := range parseChecksums(data) {
+			if name == "" {
+				// A zap-linux-x64.zip.sha256 file may only contain the checksum of zap-linux-x64.zip.
+				name = strings.TrimSuffix(asset.GetName(), filepath.Ext(asset.GetName()))
+			}
+			checksums[name] = expectedChecksum{sha256: sum, source: asset.GetName(), signed: signed}
+		}
+	}
+	for _, pin := range d.cfg.Checksums {
+		if pin.Release == "" || pin.Release == release.GetTagName() {
+			checksums[pin.Asset] = expectedChecksum{sha256: strings.ToLower(pin.Sha256), source: "the config file"}
+		}
+	}
+	return checksums, signedFiles, nil
+}
+
+// Reads a small asset into memory. In offline mode, the copy in the release directory is read instead,
+// and found is false if there is none.
+func (d *downloader) read(ctx context.Context, asset *github.ReleaseAsset, releaseDirectory string) (data []byte, found bool, err error) {
+	if !d.cfg.Offline {
+		data, err = d.fetch(ctx, asset)
+		return data, err == nil, err
+	}
+	data, err = os.ReadFile(filepath.Join(releaseDirectory, asset.GetName()))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	return data, err == nil, err
+}
+
+// Reads the contents of a small asset into memory.
+func (d *downloader) fetch(ctx context.Context, asset *github.ReleaseAsset) ([]byte, error) {
+	var data []byte
+	err := d.client.withRetry(ctx, fmt.Sprintf("download of asset '%v'", asset.GetName()), func() (*github.Response, error) {
+		rc, redirect, err := d.client.Repositories.DownloadReleaseAsset(ctx, d.cfg.Owner, d.cfg.Repo, asset.GetID())
+		if err != nil {
+			return nil, err
+		}
+		if rc == nil {
+			if u, err := url.Parse(redirect); err != nil || (!d.sec.allowHttp && u.Scheme == "http") {
+				return nil, fmt.Errorf("only secure encrypted HTTPS protocol is allowed, downloads via HTTP are blocked: %v", redirect)
+			}
+			request, err := http.NewRequestWithContext(ctx, http.MethodGet, redirect, nil)
+			if err != nil {
+				return nil, err
+			}
+			response, err := d.http.Do(request)
+			if err != nil {
+				return nil, err
+			}
+			if response.StatusCode != http.StatusOK {
+				response.Body.Close()
+				return nil, &httpStatusError{StatusCode: response.StatusCode}
+			}
+			rc = response.Body
+		}
+		defer rc.Close()
+		data, err = io.ReadAll(io.LimitReader(rc, maxChecksumFileSize))
+		return nil, err
+	})
+	return data, err
+}
+
+// Returns an error if the size or the SHA-256 of a downloaded file don't match the expected ones.
+func (e *expectedChecksum) verify(name string, size int64, hasher hash.Hash) error {
+	if e.size >= 0 && size != e.size {
+		return fmt.Errorf("size mismatch for %v: expected %v bytes, got %v", name, e.size, size)
+	}
+	if e.sha256 == "" {
+		return nil
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != e.sha256 {
+		return fmt.Errorf("SHA-256 mismatch for %v: expected %v from %v, got %v", name, e.sha256, e.source, actual)
+	}
+	return nil
+}
+
+// Returns true if the file at path has the expected size and SHA-256.
+func (e *expectedChecksum) matchesFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	hasher := sha256.New()
+	return hashFile(hasher, path) == nil && e.verify(path, info.Size(), hasher) == nil
+}
+
+// Adds the contents of a file to a hash.
+func hashFile(hasher hash.Hash, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(hasher, file)
+	return err
+}
+
+// Verifies the files of a release that were downloaded from somewhere other than Github, against
+// the checksums pinned in the config file. Files that don't match are removed.
+func VerifyPinnedChecksums(cfg *GithubConfiguration, release string, directory string) error {
+	for _, pin := range cfg.Checksums {
+		if pin.Release != "" && pin.Release != release {
+			continue
+		}
+		path := filepath.Join(directory, pin.Asset)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		expected := expectedChecksum{size: -1, sha256: strings.ToLower(pin.Sha256), source: "the config file"}
+		if !expected.matchesFile(path) {
+			os.Remove(path)
+			return fmt.Errorf("SHA-256 mismatch for %v: expected %v from the config file, the file was removed", path, expected.sha256)
+		}
+		fmt.Printf("Verified SHA-256 of %v.\n", path)
+	}
+	return nil
+}
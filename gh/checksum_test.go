@@ -0,0 +1,25 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import "testing"
+
+func TestIsChecksumAsset(t *testing.T) {
+	tests := map[string]bool{
+		"SHA256SUMS":                true,
+		"zap_2024.03.14_SHA256SUMS": true,
+		"checksums.txt":             true,
+		"zap-linux-x64.zip.sha256":  true,
+		"SHA256SUMS.sig":            false,
+		"SHA256SUMS.asc":            false,
+		"SHA256SUMS.minisig":        false,
+		"checksums.txt.sig":         false,
+		"zap-linux-x64.zip":         false,
+	}
+	for name, want := range tests {
+		if got := isChecksumAsset(name); got != want {
+			t.Errorf("isChecksumAsset(%v) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -5,27 +5,57 @@ package gh
 
 import (
 	"context"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"path/filepath"
+	"silabs/get-zap/progress"
+	"silabs/get-zap/throttle"
 	"strings"
 
 	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
+	"golang.org/x/net/http/httpproxy"
 )
 
+// DownloadOptions configure the connections to Github, both for API requests and asset downloads.
 type DownloadOptions struct {
 	skipCertCheck  bool
 	proxyUrl       *url.URL
 	allowHttp      bool
 	showPercentage bool
+	// PEM files with additional CA certificates that are trusted besides the system ones.
+	caBundles []string
+	// PEM files of the client certificate and its key, for servers that require mutual TLS.
+	clientCert string
+	clientKey  string
+	// Proxy rules by host, checked before the proxy and the proxy environment variables.
+	proxyRules []ProxyRule
+	// Hosts that are connected to without the proxy, in the format of NO_PROXY. Empty uses NO_PROXY.
+	noProxy string
+	// Credentials for proxies whose URL has none.
+	proxyUser     string
+	proxyPassword string
+	// Proxy environment variables, as they were when the options were created.
+	environment httpproxy.Config
+	// If true, the proxy of each request is logged.
+	debug bool
+	// Maximum size of a download in bytes, 0 for no limit.
+	maxSize int64
+	// Reports the progress of downloads. If nil, a reporter is created according to showPercentage.
+	progress *progress.Reporter
+	// Limits the rate of downloads, nil for no limit.
+	limiter *throttle.Limiter
 }
 
 func (dso *DownloadOptions) SetProxy(proxyS string) error {
-	url, err := url.Parse(proxyS)
+	url, err := parseProxyUrl(proxyS)
 	if err != nil {
 		return err
 	}
@@ -33,6 +63,62 @@ func (dso *DownloadOptions) SetProxy(proxyS string) error {
 	return nil
 }
 
+// Sets the proxy rules by host. Returns an error if a rule has an invalid proxy URL.
+func (dso *DownloadOptions) SetProxyRules(rules []ProxyRule) error {
+	for _, rule := range rules {
+		if rule.Proxy != "" && !strings.EqualFold(rule.Proxy, DirectProxy) {
+			if _, err := parseProxyUrl(rule.Proxy); err != nil {
+				return err
+			}
+		}
+	}
+	dso.proxyRules = rules
+	return nil
+}
+
+func (dso *DownloadOptions) SetNoProxy(noProxy string) {
+	dso.noProxy = noProxy
+}
+
+func (dso *DownloadOptions) SetProxyCredentials(user string, password string) {
+	dso.proxyUser = user
+	dso.proxyPassword = password
+}
+
+// Returns true if a proxy, proxy rules, no-proxy hosts or proxy credentials are configured,
+// i.e. if the proxy environment variables alone don't select the proxy.
+func (dso *DownloadOptions) HasProxySettings() bool {
+	return dso.proxyUrl != nil || len(dso.proxyRules) > 0 || dso.noProxy != "" || dso.proxyUser != ""
+}
+
+func (dso *DownloadOptions) SetDebug(debug bool) {
+	dso.debug = debug
+}
+
+func (dso *DownloadOptions) SetMaxSize(maxSize int64) {
+	dso.maxSize = maxSize
+}
+
+func (dso *DownloadOptions) SetProgress(reporter *progress.Reporter) {
+	dso.progress = reporter
+}
+
+func (dso *DownloadOptions) SetLimiter(limiter *throttle.Limiter) {
+	dso.limiter = limiter
+}
+
+// Returns the progress reporter of downloads.
+func (dso *DownloadOptions) reporter() *progress.Reporter {
+	if dso.progress == nil {
+		mode := progress.Auto
+		if !dso.showPercentage {
+			mode = progress.None
+		}
+		dso.progress, _ = progress.New(mode)
+	}
+	return dso.progress
+}
+
 func (dso *DownloadOptions) SetSkipCertCheck(skipCertCheck bool) {
 	dso.skipCertCheck = skipCertCheck
 }
@@ -45,6 +131,54 @@ func (dso *DownloadOptions) SetShowPercentage(showPercentage bool) {
 	dso.showPercentage = showPercentage
 }
 
+// Trusts the CA certificates of a PEM file, besides the system ones. Empty paths are ignored.
+func (dso *DownloadOptions) AddCaBundle(caBundle string) {
+	if caBundle != "" {
+		dso.caBundles = append(dso.caBundles, caBundle)
+	}
+}
+
+// Sets the client certificate for mutual TLS. The key may be in the certificate file, if keyFile is empty.
+func (dso *DownloadOptions) SetClientCertificate(certFile string, keyFile string) {
+	if keyFile == "" {
+		keyFile = certFile
+	}
+	dso.clientCert = certFile
+	dso.clientKey = keyFile
+}
+
+// Creates the HTTP transport for connections to Github. The proxy of each request is chosen by ProxyFor.
+func (dso *DownloadOptions) Transport() (*http.Transport, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: dso.skipCertCheck}
+	if len(dso.caBundles) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		for _, caBundle := range dso.caBundles {
+			pem, err := os.ReadFile(caBundle)
+			if err != nil {
+				return nil, err
+			}
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates found in CA bundle %v", caBundle)
+			}
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if dso.clientCert != "" {
+		certificate, err := tls.LoadX509KeyPair(dso.clientCert, dso.clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate %v: %v", dso.clientCert, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+	tr.Proxy = dso.ProxyFunc()
+	return tr, nil
+}
+
 // Returns the default security options.
 func DefaultSecurityOptions() *DownloadOptions {
 	s := DownloadOptions{
@@ -52,91 +186,241 @@ func DefaultSecurityOptions() *DownloadOptions {
 		proxyUrl:       nil,
 		allowHttp:      false,
 		showPercentage: true,
+		environment:    proxyEnvironment(),
 	}
 	return &s
 }
 
-// If local only is true, then only assets matching the local platform will be downloaded
-func DownloadAssets(cfg *GithubConfiguration, destinationDirectory string, localOnly bool, suffixOnly string) {
-
-	client := CreateGithubClient(cfg)
-	var release *github.RepositoryRelease
-	// Get latest release
-	if cfg.Release == "latest" {
-		r, _, err := client.Repositories.GetLatestRelease(context.Background(), cfg.Owner, cfg.Repo)
+// Downloads the assets of the configured release that are selected by the asset and exclude settings.
+// With the 'local' asset setting, the best asset is selected for each of the configured platforms.
+// With the 'all' release, the assets of every release picked by ResolveReleases are downloaded.
+// Returns the paths of the release files.
+func DownloadAssets(ctx context.Context, client *GithubClient, cfg *GithubConfiguration, destinationDirectory string) []string {
+	if cfg.Release == "all" {
+		releases, err := ResolveReleases(ctx, client, cfg)
 		cobra.CheckErr(err)
-		release = r
-	} else if cfg.Release == "all" {
-		fmt.Println("Downloading assets for all releases is not supported. Please use 'latest' or specific release.")
-		return
-	} else {
-		release = findRelease(client, cfg.Owner, cfg.Repo, cfg.Release)
-		if release == nil {
-			fmt.Printf("Could not find release '%v'\n", cfg.Release)
-			return
-		}
+		return downloadReleases(ctx, client, cfg, releases, destinationDirectory)
 	}
-	fmt.Printf("Downloading assets for release '%v' of repo '%v/%v':\n", release.GetTagName(), cfg.Owner, cfg.Repo)
-	printRelease(client, cfg.Owner, cfg.Repo, release)
-	assets, _, err := client.Repositories.ListReleaseAssets(context.Background(), cfg.Owner, cfg.Repo, release.GetID(), &github.ListOptions{})
+	release := ResolveRelease(ctx, client, cfg)
+	if release == nil {
+		cobra.CheckErr(fmt.Errorf("could not find release '%v'", cfg.Release))
+	}
+	d := newDownloader(client, cfg)
+	jobs, files, _, err := d.planRelease(ctx, release, destinationDirectory)
 	cobra.CheckErr(err)
-	for _, asset := range assets {
+	cobra.CheckErr(errors.Join(d.run(ctx, jobs)...))
+	if !cfg.DryRun {
+		cobra.CheckErr(VerifyProvenance(cfg, filepath.Join(destinationDirectory, release.GetTagName())))
+	}
+	return files
+}
 
-		if localOnly {
-			assetOs, assetArch := DetermineAssetPlatform(asset.GetName())
-			if !IsLocalAsset(assetOs, assetArch) {
-				fmt.Printf("Skipping asset '%v' [os='%v', arch='%v'] as it does not match the local platform.\n", asset.GetName(), assetOs, assetArch)
-				continue
+// Downloads the assets of several releases, each into its own directory. A failing release
+// does not stop the others, but makes the whole download fail after the summary is printed.
+func downloadReleases(ctx context.Context, client *GithubClient, cfg *GithubConfiguration, releases []*github.RepositoryRelease, destinationDirectory string) []string {
+	var allJobs []downloadJob
+	var allFiles []string
+	failed := map[string]bool{}
+	totalSkipped := 0
+	d := newDownloader(client, cfg)
+	for _, release := range releases {
+		jobs, files, skipped, err := d.planRelease(ctx, release, destinationDirectory)
+		if err != nil {
+			fmt.Printf("Failed to download release '%v': %v\n", release.GetTagName(), err)
+			failed[release.GetTagName()] = true
+			continue
+		}
+		allJobs = append(allJobs, jobs...)
+		allFiles = append(allFiles, files...)
+		totalSkipped += skipped
+	}
+	downloaded := 0
+	for i, err := range d.run(ctx, allJobs) {
+		if err != nil {
+			failed[allJobs[i].release.GetTagName()] = true
+		} else {
+			downloaded++
+		}
+	}
+	var failedTags []string
+	for _, release := range releases {
+		if !failed[release.GetTagName()] && !cfg.DryRun {
+			if err := VerifyProvenance(cfg, filepath.Join(destinationDirectory, release.GetTagName())); err != nil {
+				fmt.Printf("Failed to verify release '%v': %v\n", release.GetTagName(), err)
+				failed[release.GetTagName()] = true
 			}
 		}
-
-		if suffixOnly != "" && !strings.HasSuffix(asset.GetName(), suffixOnly) {
-			fmt.Printf("Skipping asset '%v' as it does not have the suffix '%v'.\n", asset.GetName(), suffixOnly)
-			continue
+		if failed[release.GetTagName()] {
+			failedTags = append(failedTags, release.GetTagName())
 		}
+	}
+	fmt.Printf("Summary: %v releases, %v files downloaded, %v files already present, %v releases failed.\n", len(releases), downloaded, totalSkipped, len(failedTags))
+	if len(failedTags) > 0 {
+		cobra.CheckErr(fmt.Errorf("failed to download releases: %v", strings.Join(failedTags, ", ")))
+	}
+	return allFiles
+}
 
-		rc, redirect, err := client.Repositories.DownloadReleaseAsset(context.Background(), cfg.Owner, cfg.Repo, asset.GetID())
-		cobra.CheckErr(err)
-		err = os.MkdirAll(release.GetName(), 0775)
-		cobra.CheckErr(err)
-		if rc != nil {
-			err = downloadFileFromReadCloser(rc, release.GetName(), asset.GetName())
-			cobra.CheckErr(err)
-		} else {
-			err = downloadFileFromUrl(redirect, release.GetName(), asset.GetName(), DefaultSecurityOptions())
-			cobra.CheckErr(err)
+// Selects the assets of a release that need to be downloaded into a directory named after its tag.
+// Assets that are already present with the expected size and checksum are skipped. Returns the
+// download jobs, the paths of all release files including the skipped ones, and the number of skipped files.
+func (d *downloader) planRelease(ctx context.Context, release *github.RepositoryRelease, destinationDirectory string) ([]downloadJob, []string, int, error) {
+	client, cfg := d.client, d.cfg
+	fmt.Printf("Downloading assets for release '%v' of repo '%v/%v':\n", release.GetTagName(), cfg.Owner, cfg.Repo)
+	assets := listReleaseAssets(ctx, client, cfg.Owner, cfg.Repo, release)
+	printReleaseAssets(release, assets)
+
+	targets := cfg.Platforms
+	if cfg.Asset != "local" {
+		// Platforms don't matter when assets are selected by name.
+		targets = []Platform{{}}
+	}
+	releaseDirectory := filepath.Join(destinationDirectory, release.GetTagName())
+	var checksums map[string]expectedChecksum
+	var signedFiles []releaseFile
+	if !cfg.DryRun {
+		var err error
+		if checksums, signedFiles, err = d.releaseChecksums(ctx, release, assets, releaseDirectory); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	signatures := signatureAssets(assets)
+	usesSignedChecksums := false
+	planned := map[int64]bool{}
+	var jobs []downloadJob
+	var files []string
+	skipped := 0
+	plan := func(asset *github.ReleaseAsset) error {
+		// Platform independent assets match every platform, but only need to be downloaded once.
+		if planned[asset.GetID()] {
+			return nil
+		}
+		planned[asset.GetID()] = true
+		path := filepath.Join(releaseDirectory, asset.GetName())
+		if cfg.DryRun {
+			fmt.Printf("Dry run: would download '%v' [%v bytes] to %v\n", asset.GetName(), asset.GetSize(), releaseDirectory)
+			return nil
+		}
+		files = append(files, path)
+		expected := checksums[asset.GetName()]
+		expected.size = int64(asset.GetSize())
+		usesSignedChecksums = usesSignedChecksums || expected.signed
+		signature := signatures[asset.GetName()]
+		if signature != nil && !d.verifier.canVerify(signature.GetName()) {
+			signature = nil
+		}
+		if cfg.RequireSignature && signature == nil && !expected.signed {
+			return fmt.Errorf("asset '%v' has no signature that can be verified with the configured keys", asset.GetName())
+		}
+		signaturePath := ""
+		if signature != nil {
+			signaturePath = filepath.Join(releaseDirectory, signature.GetName())
+			files = append(files, signaturePath)
+		}
+		if info, err := os.Stat(path); err == nil && info.Size() == expected.size && (expected.sha256 == "" || expected.matchesFile(path)) && (signature == nil || d.verifyLocalSignature(signaturePath, path)) {
+			fmt.Printf("Skipping asset '%v' as it is already present.\n", path)
+			skipped++
+			return nil
+		}
+		jobs = append(jobs, downloadJob{release: release, asset: asset, directory: releaseDirectory, expected: expected, signature: signature})
+		return nil
+	}
+	candidates, err := filterAssets(cfg, assets)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	for _, target := range targets {
+		selected, err := selectPlatformAssets(cfg, release, assets, candidates, target)
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		for _, asset := range selected {
+			if err := plan(asset); err != nil {
+				return nil, nil, 0, err
+			}
+		}
+	}
+	if cfg.VerifyProvenance {
+		// Provenance attestations are kept next to the assets, so that they are verified and cached together.
+		found := false
+		for _, asset := range assets {
+			if isProvenanceAsset(asset.GetName()) {
+				found = true
+				if err := plan(asset); err != nil {
+					return nil, nil, 0, err
+				}
+			}
+		}
+		if !found {
+			return nil, nil, 0, fmt.Errorf("release '%v' has no SLSA provenance (*%v)", release.GetTagName(), ProvenanceSuffix)
+		}
+	}
+	if usesSignedChecksums {
+		// Signed checksum files are kept next to the assets, so that they are cached together.
+		if err := os.MkdirAll(releaseDirectory, 0775); err != nil {
+			return nil, nil, 0, err
+		}
+		for _, file := range signedFiles {
+			path := filepath.Join(releaseDirectory, file.name)
+			if err := writeFileAtomic(path, file.data); err != nil {
+				return nil, nil, 0, err
+			}
+			files = append(files, path)
 		}
 	}
+	return jobs, files, skipped, nil
 }
 
-func downloadFileFromReadCloser(rc io.ReadCloser, destinationDirectory string, destinationPath string) error {
+// Writes the contents of rc into the destination path, through a temporary file that is only
+// renamed into place once everything has been written and verified.
+func downloadFileFromReadCloser(ctx context.Context, rc io.ReadCloser, destinationDirectory string, destinationPath string, expected *expectedChecksum, sec *DownloadOptions, out *progress.Reporter) error {
 	defer rc.Close()
-	output, err := os.Create(destinationDirectory + "/" + destinationPath)
+	output, err := createTempFile(destinationDirectory, destinationPath)
 	if err != nil {
 		return err
 	}
-	defer output.Close()
-	_, err = io.Copy(output, rc)
-	return err
-}
-
-// This function downloads a file from a given URL and puts it into the
-// destination path.
-func downloadFileFromUrl(urlAsString string, destinationDirectory string, destinationPath string, sec *DownloadOptions) error {
-
-	tlsConfig := &tls.Config{}
-	if sec.skipCertCheck {
-		tlsConfig.InsecureSkipVerify = sec.skipCertCheck
+	hasher := sha256.New()
+	transfer := out.Start(destinationPath, expected.size, 0)
+	size, err := copyDownload(io.MultiWriter(output, hasher), sec.limiter.Reader(ctx, rc), 0, sec.maxSize, transfer)
+	if errors.Is(err, errTooLarge) {
+		err = fmt.Errorf("%v: %w", destinationPath, err)
 	}
-
-	tr := &http.Transport{
-		TLSClientConfig: tlsConfig,
+	if err == nil {
+		err = expected.verify(destinationPath, size, hasher)
+	}
+	if err == nil && expected.verifySignature != nil {
+		err = expected.verifySignature(output.Name())
+	}
+	if err == nil {
+		err = commitFile(output, filepath.Join(destinationDirectory, destinationPath))
+		if err != nil {
+			os.Remove(output.Name())
+		}
+	} else {
+		discardFile(output)
 	}
-	if sec.proxyUrl != nil {
-		tr.Proxy = http.ProxyURL(sec.proxyUrl)
+	if err != nil {
+		transfer.Fail(err)
+		return err
 	}
+	transfer.Done()
+	return nil
+}
+
+// Creates the HTTP client used for downloads from URLs, according to the download options.
+func newHttpClient(sec *DownloadOptions) (*http.Client, error) {
+	tr, err := sec.Transport()
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: tr}, nil
+}
 
-	client := &http.Client{Transport: tr}
+// This function downloads a file from a given URL and puts it into the
+// destination path. The file is written to a .part file first, and renamed once it is complete
+// and matches the expected size and checksum. If the server supports it, an interrupted download
+// is resumed on the next run.
+func downloadFileFromUrl(ctx context.Context, client *http.Client, urlAsString string, destinationDirectory string, destinationPath string, expected *expectedChecksum, sec *DownloadOptions, out *progress.Reporter) error {
 
 	u, err := url.Parse(urlAsString)
 	if err != nil {
@@ -147,52 +431,167 @@ func downloadFileFromUrl(urlAsString string, destinationDirectory string, destin
 		return fmt.Errorf("only secure encrypted HTTPS protocol is allowed, downloads via HTTP are blocked: %v", urlAsString)
 	}
 
+	path := filepath.Join(destinationDirectory, destinationPath)
+	meta, offset := readPartMetadata(path)
+	if meta != nil {
+		out.Printf("Resuming download of %v at %v out of %v bytes ...\n", destinationPath, offset, meta.Size)
+	}
+
 	// Security alert: Let's do an actual get now
-	response, err := client.Get(urlAsString)
+	response, offset, err := requestDownload(ctx, client, urlAsString, path, meta, offset)
 	if err != nil {
 		return err
 	}
-	if response.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error: %v", response.StatusCode)
+	defer response.Body.Close()
+
+	// Chunked responses don't tell their length, then the size is unknown (-1).
+	size := response.ContentLength
+	if offset > 0 {
+		size = meta.Size
+	}
+	if sec.maxSize > 0 && size > sec.maxSize {
+		removePart(path)
+		return fmt.Errorf("%v is %v bytes, more than the maximum size of %v bytes", destinationPath, size, sec.maxSize)
 	}
 
-	defer response.Body.Close()
+	var flags int
+	if offset > 0 {
+		flags = os.O_WRONLY | os.O_APPEND
+	} else {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		if isResumable(response) {
+			err = writePartMetadata(path, &partMetadata{Url: urlAsString, ETag: response.Header.Get("ETag"), Size: response.ContentLength})
+		} else {
+			err = os.Remove(path + PartMetadataSuffix)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
 
-	len := response.ContentLength
-	fmt.Printf("Downloading %v bytes to %v ...\n", len, destinationPath)
+	if size >= 0 {
+		out.Printf("Downloading %v bytes to %v ...\n", size-offset, destinationPath)
+	} else {
+		out.Printf("Downloading %v, size unknown ...\n", destinationPath)
+	}
 
-	output, err := os.Create(destinationDirectory + "/" + destinationPath)
+	output, err := os.OpenFile(path+PartSuffix, flags, 0664)
 	if err != nil {
 		return err
 	}
 	defer output.Close()
 
-	var chunk int64
-	if len > 100 {
-		chunk = len / 100
-	} else {
-		chunk = len
+	// The checksum is computed while streaming, starting with what an earlier run downloaded.
+	hasher := sha256.New()
+	if offset > 0 {
+		if err := hashFile(hasher, path+PartSuffix); err != nil {
+			return err
+		}
 	}
-	cnt := 0
-	var totalDownloaded int64 = 0
-	for {
-		written, err := io.CopyN(output, response.Body, chunk)
-		totalDownloaded += written
-		percentage := (100 * totalDownloaded) / len
+	transfer := out.Start(destinationPath, size, offset)
+	totalDownloaded, downloadErr := copyDownload(io.MultiWriter(output, hasher), sec.limiter.Reader(ctx, response.Body), offset, sec.maxSize, transfer)
+	if downloadErr == nil && size >= 0 && totalDownloaded != size {
+		downloadErr = fmt.Errorf("download of %v was interrupted after %v out of %v bytes: %w", destinationPath, totalDownloaded, size, io.ErrUnexpectedEOF)
+	}
+	if downloadErr != nil {
+		transfer.Fail(downloadErr)
+	}
+	if errors.Is(downloadErr, errTooLarge) {
+		// There is no point in resuming a download that is too large.
+		discardFile(output)
+		removePart(path)
+		return fmt.Errorf("%v: %w", destinationPath, downloadErr)
+	}
+	if downloadErr != nil {
+		// A resumable download keeps its .part file for the next run, anything else is removed.
+		if _, err := os.Stat(path + PartMetadataSuffix); err != nil {
+			discardFile(output)
+		}
+		return downloadErr
+	}
+	err = expected.verify(destinationPath, totalDownloaded, hasher)
+	if err == nil && expected.verifySignature != nil {
+		err = expected.verifySignature(path + PartSuffix)
+	}
+	if err != nil {
+		// Never keep a corrupt or untrusted download around, not even to resume it.
+		transfer.Fail(err)
+		discardFile(output)
+		removePart(path)
+		return err
+	}
+	transfer.Done()
+	if expected.sha256 != "" {
+		out.Printf("Verified SHA-256 of %v against %v.\n", destinationPath, expected.source)
+	}
+	if err := commitFile(output, path); err != nil {
+		return err
+	}
+	os.Remove(path + PartMetadataSuffix)
+	return nil
+}
+
+// Returned when a download exceeds the maximum size.
+var errTooLarge = errors.New("the download exceeds the maximum size")
 
+// Copies the body of a download that starts at offset into the writer, until it ends or the total exceeds
+// maxSize, if that is above 0. Adds the copied bytes to the transfer. Returns the total size, including the offset.
+func copyDownload(writer io.Writer, body io.Reader, offset int64, maxSize int64, transfer *progress.Transfer) (int64, error) {
+	total := offset
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			if _, err := writer.Write(buffer[:n]); err != nil {
+				return total, err
+			}
+			total += int64(n)
+			if maxSize > 0 && total > maxSize {
+				return total, fmt.Errorf("%w of %v bytes", errTooLarge, maxSize)
+			}
+			transfer.Add(int64(n))
+		}
 		if err == io.EOF {
-			fmt.Printf("%v%%: Downloaded %v out of %v bytes. Done!\n", percentage, totalDownloaded, len)
-			break
-			// done.
+			return total, nil
 		} else if err != nil {
-			// real error.
-			return err
-		} else {
-			if sec.showPercentage {
-				fmt.Printf("%v%%: Downloaded %v out of %v bytes...\r", percentage, totalDownloaded, len)
-			}
-			cnt++
+			return total, err
 		}
 	}
-	return nil
+}
+
+// Requests a download. With metadata of a partial download, only the remaining bytes are requested,
+// guarded by If-Range so that a changed file is sent in full. Falls back to a full download if the
+// server can't resume. Returns the response and the offset that its body starts at.
+func requestDownload(ctx context.Context, client *http.Client, urlAsString string, path string, meta *partMetadata, offset int64) (*http.Response, int64, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, urlAsString, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	if meta != nil {
+		request.Header.Set("Range", fmt.Sprintf("bytes=%v-", offset))
+		request.Header.Set("If-Range", meta.ETag)
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	switch {
+	case response.StatusCode == http.StatusOK:
+		return response, 0, nil
+	case response.StatusCode == http.StatusPartialContent && meta != nil:
+		if start, err := contentRangeStart(response); err == nil && start == offset {
+			return response, offset, nil
+		}
+	case response.StatusCode == http.StatusRequestedRangeNotSatisfiable && meta != nil:
+	default:
+		response.Body.Close()
+		return nil, 0, &httpStatusError{StatusCode: response.StatusCode}
+	}
+	// The server did not resume where we left off, so start over.
+	response.Body.Close()
+	removePart(path)
+	return requestDownload(ctx, client, urlAsString, path, nil, 0)
 }
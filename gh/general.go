@@ -6,8 +6,8 @@ package gh
 import (
 	"context"
 	"fmt"
-	"runtime"
-	"strings"
+	"net/http"
+	"time"
 
 	"github.com/google/go-github/github"
 	"github.com/spf13/cobra"
@@ -20,58 +20,134 @@ type GithubConfiguration struct {
 	Release string
 	Token   string
 	Asset   string
+	// Asset name patterns that are never downloaded.
+	Exclude []string
+	Channel string
+	// Channel rules configured for this repo, keyed by lowercase channel name.
+	ChannelRules map[string]ChannelRule
+	// If not zero, only releases published before this time are considered.
+	ReleasedBefore time.Time
+	// If not zero, only releases published at or after this time are considered.
+	ReleasedAfter time.Time
+	// Platform detection rules from the configuration file, applied before the built-in ones.
+	PlatformRules []PlatformRule
+	// Platforms that assets are selected for, when the asset setting is 'local'.
+	Platforms []Platform
+	// Fallback architectures from the configuration file, keyed by OS and then by architecture.
+	PlatformFallbacks map[string]map[string][]string
+	// Ranking used to pick one asset per platform.
+	Preference AssetPreference
+	// If true, assets are selected and reported, but not downloaded.
+	DryRun bool
+	// With the 'all' release, only the given number of newest releases are used, if not 0.
+	Last int
+	// With the 'all' release, only releases matching this version constraint are used, if not empty.
+	VersionRange string
+	// Number of assets downloaded at the same time. Values below 1 download one at a time.
+	Parallel int
+	// How failed Github requests and asset transfers are retried.
+	Retry RetryPolicy
+	// If true, an exhausted Github API rate limit is waited out instead of failing.
+	WaitForRateLimit bool
+	// Directory that Github API responses are cached in. Empty disables the cache.
+	CacheDirectory string
+	// How long cached Github API responses are used without revalidating them.
+	CacheTtl time.Duration
+	// If true, Github API responses are only taken from the cache, and nothing is downloaded from Github.
+	Offline bool
+	// SHA-256 checksums of assets from the config file.
+	Checksums []ChecksumPin
+	// Keys that the assets of this repo are signed with, from the config file.
+	SigningKeys []SigningKey
+	// If true, every downloaded asset must have a valid signature by one of the signing keys.
+	RequireSignature bool
+	// If true, the downloaded assets are verified against the SLSA provenance published with the release.
+	VerifyProvenance bool
+	// What the provenance of the assets of this repo must state, from the config file.
+	ProvenancePolicy ProvenancePolicy
+	// Proxy, TLS and progress settings for API requests and asset downloads. If nil, DefaultSecurityOptions apply.
+	Download *DownloadOptions
 }
 
-func CreateGithubClient(cfg *GithubConfiguration) *github.Client {
-	var client *github.Client
-	if cfg.Token == "" {
+// Returns the download options, or the default ones if none are configured.
+func (cfg *GithubConfiguration) downloadOptions() *DownloadOptions {
+	if cfg.Download == nil {
+		cfg.Download = DefaultSecurityOptions()
+	}
+	return cfg.Download
+}
+
+// Creates the Github client, which caches API responses and retries failed requests according to the configuration.
+func CreateGithubClient(cfg *GithubConfiguration) *GithubClient {
+	sec := cfg.downloadOptions()
+	transport, err := sec.Transport()
+	cobra.CheckErr(err)
+	httpClient := &http.Client{Transport: transport}
+	if cfg.Token == "" && !cfg.Offline {
 		fmt.Println("You do not have GET_ZAP_GHTOKEN set. This will limit the number of requests you can make to the github API.")
 		fmt.Println("In order to get Github token:\n  1. go to your settings at https://github.com/settings/profile\n  2. follow 'Developer Settings' -> 'Personal access tokens'\n  3. Create a token.\n  4. Add it to GET_ZAP_GHTOKEN environment variable or use --ghToken argument.")
-		client = github.NewClient(nil)
-	} else {
-		ctx := context.Background()
+	} else if cfg.Token != "" {
+		// The oauth2 client sends its requests through the configured transport.
+		ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
 		ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: cfg.Token})
-		tc := oauth2.NewClient(ctx, ts)
-		client = github.NewClient(tc)
+		httpClient = oauth2.NewClient(ctx, ts)
 	}
-	return client
+	// API responses are cached on disk, see cacheTransport.
+	httpClient.Transport = newCacheTransport(httpClient.Transport, cfg)
+	return &GithubClient{Client: github.NewClient(httpClient), retry: cfg.Retry, waitForRateLimit: cfg.WaitForRateLimit, out: sec.reporter()}
 }
 
-func DetermineAssetPlatform(assetName string) (os string, arch string) {
-	os = ""
-	arch = ""
-	if strings.Contains(assetName, "-windows") || strings.Contains(assetName, "-win") {
-		os = "windows"
-	} else if strings.Contains(assetName, "-darwin") || strings.Contains(assetName, "-mac") || strings.Contains(assetName, "-osx") {
-		os = "darwin"
-	} else if strings.Contains(assetName, "-linux") {
-		os = "linux"
-	}
-	if strings.Contains(assetName, "-amd64") || strings.Contains(assetName, "-x64") || strings.Contains(assetName, "-x86_64") {
-		arch = "amd64"
-	} else if strings.Contains(assetName, "-arm64") || strings.Contains(assetName, "-aarch64") {
-		arch = "arm64"
-	}
-	return
-}
+// Maximum number of items per page that the Github API will return.
+const MaxPageSize = 100
 
-func IsLocalAsset(assetOs string, assetArch string) bool {
-	if assetOs == "" {
-		return true
+// Retrieves the releases of a repo, following the pagination until either all releases
+// are retrieved, or limit releases have been collected. A limit of 0 means no limit.
+func listReleases(ctx context.Context, client *GithubClient, owner string, repo string, limit int, pageSize int) []*github.RepositoryRelease {
+	if pageSize <= 0 || pageSize > MaxPageSize {
+		pageSize = MaxPageSize
 	}
-	if assetOs != runtime.GOOS {
-		return false
+	if limit > 0 && limit < pageSize {
+		pageSize = limit
 	}
-	if assetArch != "" && assetArch != runtime.GOARCH {
-		return false
+	opts := &github.ListOptions{PerPage: pageSize}
+	var allReleases []*github.RepositoryRelease
+	for {
+		var releases []*github.RepositoryRelease
+		var resp *github.Response
+		err := client.withRetry(ctx, "listing releases", func() (*github.Response, error) {
+			var err error
+			releases, resp, err = client.Repositories.ListReleases(ctx, owner, repo, opts)
+			return resp, err
+		})
+		cobra.CheckErr(err)
+		allReleases = append(allReleases, releases...)
+		if limit > 0 && len(allReleases) >= limit {
+			return allReleases[:limit]
+		}
+		if resp.NextPage == 0 {
+			return allReleases
+		}
+		opts.Page = resp.NextPage
 	}
-	return true
 }
 
-func findRelease(client *github.Client, owner string, repo string, tag string) *github.RepositoryRelease {
-	allReleases, _, err := client.Repositories.ListReleases(context.Background(), owner, repo, &github.ListOptions{})
-	cobra.CheckErr(err)
-	for _, release := range allReleases {
+func findRelease(ctx context.Context, client *GithubClient, owner string, repo string, tag string) *github.RepositoryRelease {
+	// Exact tags can be looked up directly, without paging through all releases.
+	var release *github.RepositoryRelease
+	var resp *github.Response
+	err := client.withRetry(ctx, fmt.Sprintf("looking up release '%v'", tag), func() (*github.Response, error) {
+		var err error
+		release, resp, err = client.Repositories.GetReleaseByTag(ctx, owner, repo, tag)
+		return resp, err
+	})
+	if err == nil {
+		return release
+	}
+	if resp == nil || resp.StatusCode != http.StatusNotFound {
+		cobra.CheckErr(err)
+	}
+	// Tag lookup does not see draft releases, so we fall back to going through all of them.
+	for _, release := range listReleases(ctx, client, owner, repo, 0, MaxPageSize) {
 		if release.GetTagName() == tag {
 			return release
 		}
@@ -79,38 +155,75 @@ func findRelease(client *github.Client, owner string, repo string, tag string) *
 	return nil
 }
 
-func printRelease(client *github.Client, owner string, repo string, release *github.RepositoryRelease) {
+// Retrieves all assets of a release, following the pagination.
+func listReleaseAssets(ctx context.Context, client *GithubClient, owner string, repo string, release *github.RepositoryRelease) []*github.ReleaseAsset {
+	opts := &github.ListOptions{PerPage: MaxPageSize}
+	var allAssets []*github.ReleaseAsset
+	for {
+		var assets []*github.ReleaseAsset
+		var resp *github.Response
+		err := client.withRetry(ctx, fmt.Sprintf("listing assets of release '%v'", release.GetTagName()), func() (*github.Response, error) {
+			var err error
+			assets, resp, err = client.Repositories.ListReleaseAssets(ctx, owner, repo, release.GetID(), opts)
+			return resp, err
+		})
+		cobra.CheckErr(err)
+		allAssets = append(allAssets, assets...)
+		if resp.NextPage == 0 {
+			return allAssets
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func printRelease(ctx context.Context, client *GithubClient, owner string, repo string, release *github.RepositoryRelease) {
+	printReleaseAssets(release, listReleaseAssets(ctx, client, owner, repo, release))
+}
+
+func printReleaseAssets(release *github.RepositoryRelease, assets []*github.ReleaseAsset) {
 	fmt.Printf("  %v  [Published: %v]\n", release.GetTagName(), release.GetCreatedAt())
-	assets, _, err := client.Repositories.ListReleaseAssets(context.Background(), owner, repo, release.GetID(), &github.ListOptions{})
-	cobra.CheckErr(err)
 	for _, asset := range assets {
 		fmt.Printf("    %v [%v bytes]\n", asset.GetName(), asset.GetSize())
 	}
 }
 
-func ListGithub(cfg *GithubConfiguration) {
+// Lists releases or release assets. When listing all releases, limit caps the number of
+// releases printed (0 for no limit) and pageSize is the number of releases requested per API call.
+func ListGithub(ctx context.Context, cfg *GithubConfiguration, limit int, pageSize int) {
 	client := CreateGithubClient(cfg)
 	if cfg.Release == "all" {
 		fmt.Printf("Listing all releases of repo '%v/%v':\n", cfg.Owner, cfg.Repo)
-		allReleases, _, err := client.Repositories.ListReleases(context.Background(), cfg.Owner, cfg.Repo, &github.ListOptions{})
-		cobra.CheckErr(err)
-		for _, release := range allReleases {
+		var releases []*github.RepositoryRelease
+		if !cfg.filtersReleases() && cfg.VersionRange == "" {
+			releases = listReleases(ctx, client, cfg.Owner, cfg.Repo, limit, pageSize)
+		} else {
+			var err error
+			releases, err = filterReleases(cfg, listReleases(ctx, client, cfg.Owner, cfg.Repo, 0, pageSize))
+			cobra.CheckErr(err)
+			if limit > 0 && len(releases) > limit {
+				releases = releases[:limit]
+			}
+		}
+		for _, release := range releases {
 			fmt.Printf("  %v [Published: %v]\n", release.GetTagName(), release.GetPublishedAt())
 		}
 	} else if cfg.Release == "latest" {
 		// Get latest release
 		fmt.Printf("Viewing latest release of repo '%v/%v':\n", cfg.Owner, cfg.Repo)
-		release, _, err := client.Repositories.GetLatestRelease(context.Background(), cfg.Owner, cfg.Repo)
-		cobra.CheckErr(err)
-		printRelease(client, cfg.Owner, cfg.Repo, release)
+		rel := ResolveRelease(ctx, client, cfg)
+		if rel == nil {
+			fmt.Printf("Could not find a release matching channel '%v' and the publishing dates\n", cfg.Channel)
+		} else {
+			printRelease(ctx, client, cfg.Owner, cfg.Repo, rel)
+		}
 	} else {
-		// Get specific release
+		// Get specific release, or the newest one matching a version constraint
 		fmt.Printf("Viewing release '%v' of repo '%v/%v':\n", cfg.Release, cfg.Owner, cfg.Repo)
-		rel := findRelease(client, cfg.Owner, cfg.Repo, cfg.Release)
+		rel := ResolveRelease(ctx, client, cfg)
 		if rel == nil {
 			fmt.Printf("Could not find a release with tag '%v'\n", cfg.Release)
 		} else {
-			printRelease(client, cfg.Owner, cfg.Repo, rel)
+			printRelease(ctx, client, cfg.Owner, cfg.Repo, rel)
 		}
 	}
 
@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"silabs/get-zap/progress"
+	"sync"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/cobra"
+)
+
+// A single asset to download into a release directory.
+type downloadJob struct {
+	release   *github.RepositoryRelease
+	asset     *github.ReleaseAsset
+	directory string
+	// What the downloaded asset is verified against.
+	expected expectedChecksum
+	// Detached signature of the asset, if one can be checked with the configured keys.
+	signature *github.ReleaseAsset
+}
+
+// Downloads assets with a bounded number of workers, sharing one HTTP client.
+type downloader struct {
+	client *GithubClient
+	cfg    *GithubConfiguration
+	http   *http.Client
+	sec    *DownloadOptions
+	out    *progress.Reporter
+	// Checks signatures against the signing keys of the repo.
+	verifier *signatureVerifier
+}
+
+func newDownloader(client *GithubClient, cfg *GithubConfiguration) *downloader {
+	sec := cfg.downloadOptions()
+	httpClient, err := newHttpClient(sec)
+	cobra.CheckErr(err)
+	verifier, err := newSignatureVerifier(cfg.SigningKeys)
+	cobra.CheckErr(err)
+	return &downloader{
+		client:   client,
+		cfg:      cfg,
+		http:     httpClient,
+		sec:      sec,
+		out:      sec.reporter(),
+		verifier: verifier,
+	}
+}
+
+// Returns the number of assets that are downloaded at the same time.
+func (cfg *GithubConfiguration) workers() int {
+	if cfg.Parallel < 1 {
+		return 1
+	}
+	return cfg.Parallel
+}
+
+// Runs all jobs and returns their errors, in the order of the jobs. A failing job
+// does not stop the others, but cancelling the context stops all of them.
+func (d *downloader) run(ctx context.Context, jobs []downloadJob) []error {
+	errs := make([]error, len(jobs))
+	workers := d.cfg.workers()
+	if workers > len(jobs) {
+		workers = len(jobs)
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				if ctx.Err() != nil {
+					errs[i] = ctx.Err()
+					continue
+				}
+				errs[i] = d.download(ctx, jobs[i])
+				if errs[i] != nil {
+					d.out.Printf("Failed to download asset '%v': %v\n", jobs[i].asset.GetName(), errs[i])
+				}
+			}
+		}()
+	}
+	for i := range jobs {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return errs
+}
+
+// Downloads a single asset into the directory of its job, retrying transient failures.
+// Each attempt asks Github for a new download URL, as the previous one may have expired.
+func (d *downloader) download(ctx context.Context, job downloadJob) error {
+	return d.client.withRetry(ctx, fmt.Sprintf("download of asset '%v'", job.asset.GetName()), func() (*github.Response, error) {
+		return nil, d.downloadOnce(ctx, job)
+	})
+}
+
+func (d *downloader) downloadOnce(ctx context.Context, job downloadJob) error {
+	if err := os.MkdirAll(job.directory, 0775); err != nil {
+		return err
+	}
+	removeStaleTempFiles(job.directory, job.asset.GetName())
+	if job.signature != nil {
+		signature, err := d.fetch(ctx, job.signature)
+		if err != nil {
+			return err
+		}
+		job.expected.verifySignature = func(path string) error {
+			if err := d.verifier.verifyFile(job.signature.GetName(), signature, path); err != nil {
+				return fmt.Errorf("%v: %v", job.asset.GetName(), err)
+			}
+			d.out.Printf("Verified signature of %v.\n", job.asset.GetName())
+			// The signature is kept next to the asset, so that it is cached together with it.
+			return writeFileAtomic(filepath.Join(job.directory, job.signature.GetName()), signature)
+		}
+	}
+	rc, redirect, err := d.client.Repositories.DownloadReleaseAsset(ctx, d.cfg.Owner, d.cfg.Repo, job.asset.GetID())
+	if err != nil {
+		return err
+	}
+	if rc != nil {
+		d.out.Printf("Downloading asset '%v' to %v ...\n", job.asset.GetName(), job.directory)
+		return downloadFileFromReadCloser(ctx, rc, job.directory, job.asset.GetName(), &job.expected, d.sec, d.out)
+	}
+	return downloadFileFromUrl(ctx, d.http, redirect, job.directory, job.asset.GetName(), &job.expected, d.sec, d.out)
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// AssetPlatform is the platform an asset was built for, as determined from its name.
+// Empty fields mean that the name does not say.
+type AssetPlatform struct {
+	OS      string
+	Arch    string
+	Libc    string
+	Variant string
+}
+
+// PlatformRule assigns a value to one of the platform fields ('os', 'arch', 'libc' or 'variant')
+// of assets whose name matches a regular expression. For each field, the first matching rule wins.
+type PlatformRule struct {
+	Field   string `mapstructure:"field"`
+	Pattern string `mapstructure:"pattern"`
+	Value   string `mapstructure:"value"`
+}
+
+// Matches one of the alternatives as a separate word of an asset name, e.g. 'x64' in 'zap-linux-x64.zip'.
+func word(alternatives string) string {
+	return `(?i)(^|[^a-z0-9])(` + alternatives + `)([^a-z0-9]|$)`
+}
+
+// Built-in platform detection rules. Rules from the configuration file are applied before these.
+var DefaultPlatformRules = []PlatformRule{
+	{"os", word(`windows|win32|win64|win`), "windows"},
+	{"os", word(`darwin|macos|mac|osx`), "darwin"},
+	{"os", word(`linux`), "linux"},
+	{"os", word(`freebsd`), "freebsd"},
+	{"os", `(?i)\.(exe|msi)$`, "windows"},
+	{"os", `(?i)\.(dmg|pkg)$`, "darwin"},
+	{"os", `(?i)\.(deb|rpm|appimage)$`, "linux"},
+	{"arch", word(`amd64|x86_64|x86-64|x64`), "amd64"},
+	{"arch", word(`arm64|aarch64`), "arm64"},
+	{"arch", word(`armv7l?|armv6l?|armhf|armel|arm`), "arm"},
+	{"arch", word(`386|i386|i686|x86|ia32`), "386"},
+	{"arch", word(`riscv64`), "riscv64"},
+	{"arch", word(`ppc64le`), "ppc64le"},
+	{"arch", word(`s390x`), "s390x"},
+	{"arch", word(`universal2?`), "universal"},
+	{"libc", word(`musl|musleabi|musleabihf`), "musl"},
+	{"libc", word(`gnu|gnueabi|gnueabihf|glibc`), "glibc"},
+	{"variant", word(`cli`), "cli"},
+}
+
+type compiledPlatformRule struct {
+	field string
+	re    *regexp.Regexp
+	value string
+}
+
+// PlatformClassifier determines the platform of assets from their names, using a rule table.
+type PlatformClassifier struct {
+	rules []compiledPlatformRule
+}
+
+// Creates a classifier that applies the given rules first, followed by the built-in ones.
+func NewPlatformClassifier(overrides []PlatformRule) (*PlatformClassifier, error) {
+	pc := &PlatformClassifier{}
+	for _, rule := range append(append([]PlatformRule{}, overrides...), DefaultPlatformRules...) {
+		switch rule.Field {
+		case "os", "arch", "libc", "variant":
+		default:
+			return nil, fmt.Errorf("invalid platform rule field '%v', must be one of os, arch, libc or variant", rule.Field)
+		}
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid platform rule pattern '%v': %v", rule.Pattern, err)
+		}
+		pc.rules = append(pc.rules, compiledPlatformRule{rule.Field, re, rule.Value})
+	}
+	return pc, nil
+}
+
+func (pc *PlatformClassifier) DetermineAssetPlatform(assetName string) AssetPlatform {
+	fields := map[string]string{}
+	for _, rule := range pc.rules {
+		if _, done := fields[rule.field]; !done && rule.re.MatchString(assetName) {
+			fields[rule.field] = rule.value
+		}
+	}
+	return AssetPlatform{OS: fields["os"], Arch: fields["arch"], Libc: fields["libc"], Variant: fields["variant"]}
+}
+
+// Returns the C library of the local system: 'musl' on musl based Linux distributions,
+// 'glibc' on other Linux systems, and empty elsewhere.
+func localLibc() string {
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	if musl, _ := filepath.Glob("/lib/ld-musl-*"); len(musl) > 0 {
+		return "musl"
+	}
+	return "glibc"
+}
+
+// Platform is a platform that assets are downloaded for.
+type Platform struct {
+	OS   string
+	Arch string
+	// C library of the platform. Empty means any.
+	Libc string
+}
+
+func (p Platform) String() string {
+	if p.Libc != "" {
+		return p.OS + "/" + p.Arch + "/" + p.Libc
+	}
+	return p.OS + "/" + p.Arch
+}
+
+// Returns a name for the platform that can be used as a directory name, e.g. 'linux-amd64'.
+func (p Platform) Dir() string {
+	return strings.ReplaceAll(p.String(), "/", "-")
+}
+
+// Returns the platform this program runs on.
+func LocalPlatform() Platform {
+	return Platform{OS: runtime.GOOS, Arch: runtime.GOARCH, Libc: localLibc()}
+}
+
+// Parses a platform given as 'os/arch' or 'os/arch/libc'.
+func ParsePlatform(s string) (Platform, error) {
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, fmt.Errorf("invalid platform '%v', use os/arch, e.g. 'darwin/arm64'", s)
+	}
+	p := Platform{OS: parts[0], Arch: parts[1]}
+	if len(parts) == 3 {
+		p.Libc = parts[2]
+	}
+	return p, nil
+}
+
+// Returns the platforms to download assets for. Platforms given as 'os/arch' are used as is,
+// and the os and arch overrides add one more platform, filled in from the local platform.
+// Without any of them, the local platform is returned.
+func TargetPlatforms(targetOs string, targetArch string, platforms []string) ([]Platform, error) {
+	var targets []Platform
+	for _, s := range platforms {
+		p, err := ParsePlatform(s)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, p)
+	}
+	if targetOs != "" || targetArch != "" {
+		p := Platform{OS: targetOs, Arch: targetArch}
+		if p.OS == "" {
+			p.OS = runtime.GOOS
+		}
+		if p.Arch == "" {
+			p.Arch = runtime.GOARCH
+		}
+		targets = append(targets, p)
+	}
+	if len(targets) == 0 {
+		targets = append(targets, LocalPlatform())
+	}
+	return targets, nil
+}
+
+// Returns true if an asset of this platform can be used on the target platform.
+// Assets that don't name an OS are considered platform independent.
+func (p AssetPlatform) Matches(target Platform) bool {
+	if p.OS == "" {
+		return true
+	}
+	if p.OS != target.OS {
+		return false
+	}
+	if p.Arch != "" && p.Arch != target.Arch && !(p.Arch == "universal" && p.OS == "darwin") {
+		return false
+	}
+	if p.Libc != "" && target.Libc != "" && p.Libc != target.Libc {
+		return false
+	}
+	return true
+}
+
+// Returns true if an asset of the given platform can be used on the local platform.
+func IsLocalAsset(p AssetPlatform) bool {
+	return p.Matches(LocalPlatform())
+}
+
+// Prints how each asset of the configured release is classified by the platform rules.
+func ListPlatforms(ctx context.Context, cfg *GithubConfiguration) {
+	pc, err := NewPlatformClassifier(cfg.PlatformRules)
+	cobra.CheckErr(err)
+	client := CreateGithubClient(cfg)
+	release := ResolveRelease(ctx, client, cfg)
+	if release == nil {
+		fmt.Printf("Could not find release '%v'\n", cfg.Release)
+		return
+	}
+	fmt.Printf("Platforms of the assets of release '%v' of repo '%v/%v':\n", release.GetTagName(), cfg.Owner, cfg.Repo)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  ASSET\tOS\tARCH\tLIBC\tVARIANT\tLOCAL")
+	for _, asset := range listReleaseAssets(ctx, client, cfg.Owner, cfg.Repo, release) {
+		p := pc.DetermineAssetPlatform(asset.GetName())
+		fmt.Fprintf(w, "  %v\t%v\t%v\t%v\t%v\t%v\n", asset.GetName(), orDash(p.OS), orDash(p.Arch), orDash(p.Libc), orDash(p.Variant), IsLocalAsset(p))
+	}
+	w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,132 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"testing"
+)
+
+func TestDetermineAssetPlatform(t *testing.T) {
+	tests := []struct {
+		name string
+		want AssetPlatform
+	}{
+		// Assets of zap releases.
+		{"zap-linux-x64.zip", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"zap-linux-arm64.zip", AssetPlatform{OS: "linux", Arch: "arm64"}},
+		{"zap-linux-x64.deb", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"zap-linux-x64.rpm", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"zap-mac-x64.zip", AssetPlatform{OS: "darwin", Arch: "amd64"}},
+		{"zap-mac-arm64.zip", AssetPlatform{OS: "darwin", Arch: "arm64"}},
+		{"zap-win-x64.zip", AssetPlatform{OS: "windows", Arch: "amd64"}},
+		{"zap-win-arm64.zip", AssetPlatform{OS: "windows", Arch: "arm64"}},
+		{"zap-cli-linux-x64.zip", AssetPlatform{OS: "linux", Arch: "amd64", Variant: "cli"}},
+		{"zap-linux-x64.zip.sha256", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"zap-2024.03.14.tgz", AssetPlatform{}},
+		{"SHA256SUMS", AssetPlatform{}},
+		// Go style names.
+		{"tool_linux_amd64.tar.gz", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"tool_darwin_arm64.tar.gz", AssetPlatform{OS: "darwin", Arch: "arm64"}},
+		{"tool_windows_386.zip", AssetPlatform{OS: "windows", Arch: "386"}},
+		{"tool_linux_riscv64.tar.gz", AssetPlatform{OS: "linux", Arch: "riscv64"}},
+		{"tool_linux_ppc64le.tar.gz", AssetPlatform{OS: "linux", Arch: "ppc64le"}},
+		{"tool_linux_s390x.tar.gz", AssetPlatform{OS: "linux", Arch: "s390x"}},
+		{"tool_freebsd_amd64.tar.gz", AssetPlatform{OS: "freebsd", Arch: "amd64"}},
+		// C library and 32 bit ARM.
+		{"tool-linux-x86_64-musl.tar.gz", AssetPlatform{OS: "linux", Arch: "amd64", Libc: "musl"}},
+		{"tool-linux-x86_64-glibc.tar.gz", AssetPlatform{OS: "linux", Arch: "amd64", Libc: "glibc"}},
+		{"tool-linux-armv7.tar.gz", AssetPlatform{OS: "linux", Arch: "arm"}},
+		{"tool-linux-armv7l.tar.gz", AssetPlatform{OS: "linux", Arch: "arm"}},
+		{"tool-linux-armhf.deb", AssetPlatform{OS: "linux", Arch: "arm"}},
+		{"tool-linux-i686.tar.gz", AssetPlatform{OS: "linux", Arch: "386"}},
+		{"tool-win32-ia32.zip", AssetPlatform{OS: "windows", Arch: "386"}},
+		{"tool-linux-x86.tar.gz", AssetPlatform{OS: "linux", Arch: "386"}},
+		// macOS universal binaries and installers.
+		{"tool-macos-universal.zip", AssetPlatform{OS: "darwin", Arch: "universal"}},
+		{"tool-osx-universal2.pkg", AssetPlatform{OS: "darwin", Arch: "universal"}},
+		{"Tool-1.0.dmg", AssetPlatform{OS: "darwin"}},
+		{"Tool Setup 1.0.exe", AssetPlatform{OS: "windows"}},
+		{"tool-1.0-x86_64.AppImage", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		// Rust target triples.
+		{"tool-x86_64-unknown-linux-gnu.tar.gz", AssetPlatform{OS: "linux", Arch: "amd64", Libc: "glibc"}},
+		{"tool-x86_64-unknown-linux-musl.tar.gz", AssetPlatform{OS: "linux", Arch: "amd64", Libc: "musl"}},
+		{"tool-aarch64-unknown-linux-gnu.tar.gz", AssetPlatform{OS: "linux", Arch: "arm64", Libc: "glibc"}},
+		{"tool-armv7-unknown-linux-gnueabihf.tar.gz", AssetPlatform{OS: "linux", Arch: "arm", Libc: "glibc"}},
+		{"tool-arm-unknown-linux-musleabihf.tar.gz", AssetPlatform{OS: "linux", Arch: "arm", Libc: "musl"}},
+		{"tool-i686-unknown-linux-gnu.tar.gz", AssetPlatform{OS: "linux", Arch: "386", Libc: "glibc"}},
+		{"tool-x86_64-apple-darwin.tar.gz", AssetPlatform{OS: "darwin", Arch: "amd64"}},
+		{"tool-aarch64-apple-darwin.tar.gz", AssetPlatform{OS: "darwin", Arch: "arm64"}},
+		{"tool-x86_64-pc-windows-msvc.zip", AssetPlatform{OS: "windows", Arch: "amd64"}},
+		// Words inside other words don't count.
+		{"darwinian-linux-x64.zip", AssetPlatform{OS: "linux", Arch: "amd64"}},
+		{"armada-1.0.zip", AssetPlatform{}},
+	}
+	pc, err := NewPlatformClassifier(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range tests {
+		if got := pc.DetermineAssetPlatform(test.name); got != test.want {
+			t.Errorf("DetermineAssetPlatform(%v) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPlatformRuleOverrides(t *testing.T) {
+	pc, err := NewPlatformClassifier([]PlatformRule{
+		{Field: "os", Pattern: `^firmware-`, Value: "none"},
+		{Field: "arch", Pattern: `(?i)-m1\.`, Value: "arm64"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want AssetPlatform
+	}{
+		{"firmware-linux-x64.zip", AssetPlatform{OS: "none", Arch: "amd64"}},
+		{"tool-mac-M1.zip", AssetPlatform{OS: "darwin", Arch: "arm64"}},
+		{"tool-mac-x64.zip", AssetPlatform{OS: "darwin", Arch: "amd64"}},
+	}
+	for _, test := range tests {
+		if got := pc.DetermineAssetPlatform(test.name); got != test.want {
+			t.Errorf("DetermineAssetPlatform(%v) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+	if _, err := NewPlatformClassifier([]PlatformRule{{Field: "cpu", Pattern: "x", Value: "y"}}); err == nil {
+		t.Error("NewPlatformClassifier() accepted an invalid field")
+	}
+	if _, err := NewPlatformClassifier([]PlatformRule{{Field: "os", Pattern: "(", Value: "y"}}); err == nil {
+		t.Error("NewPlatformClassifier() accepted an invalid pattern")
+	}
+}
+
+func TestAssetPlatformMatches(t *testing.T) {
+	tests := []struct {
+		asset  AssetPlatform
+		target string
+		want   bool
+	}{
+		{AssetPlatform{}, "linux/amd64", true},
+		{AssetPlatform{OS: "linux", Arch: "amd64"}, "linux/amd64", true},
+		{AssetPlatform{OS: "linux", Arch: "amd64"}, "linux/arm64", false},
+		{AssetPlatform{OS: "linux", Arch: "amd64"}, "darwin/amd64", false},
+		{AssetPlatform{OS: "linux"}, "linux/arm64", true},
+		{AssetPlatform{OS: "darwin", Arch: "universal"}, "darwin/arm64", true},
+		{AssetPlatform{OS: "linux", Arch: "universal"}, "linux/arm64", false},
+		{AssetPlatform{OS: "linux", Arch: "amd64", Libc: "musl"}, "linux/amd64", true},
+		{AssetPlatform{OS: "linux", Arch: "amd64", Libc: "musl"}, "linux/amd64/musl", true},
+		{AssetPlatform{OS: "linux", Arch: "amd64", Libc: "musl"}, "linux/amd64/glibc", false},
+		{AssetPlatform{OS: "linux", Arch: "amd64"}, "linux/amd64/glibc", true},
+	}
+	for _, test := range tests {
+		target, err := ParsePlatform(test.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := test.asset.Matches(target); got != test.want {
+			t.Errorf("%+v.Matches(%v) = %v, want %v", test.asset, test.target, got, test.want)
+		}
+	}
+}
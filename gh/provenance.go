@@ -0,0 +1,244 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Suffix of in-toto attestation files, such as the SLSA provenance published by slsa-github-generator.
+const ProvenanceSuffix = ".intoto.jsonl"
+
+// ProvenancePolicy is what the SLSA provenance of the assets of a repo must state. It is configured
+// per repo in the config file, e.g. "provenance": { "project-chip/zap": { "builderId": "...", "sourceRepository": "github.com/project-chip/zap" } }.
+type ProvenancePolicy struct {
+	// ID of the trusted builder. A builder ID with a version, such as '...@refs/tags/v1.9.0', matches it too.
+	// If empty, the builder is reported, but not checked.
+	BuilderId string `mapstructure:"builderId"`
+	// Repository the assets must be built from. If empty, the repo they are downloaded from.
+	SourceRepository string `mapstructure:"sourceRepository"`
+}
+
+// An in-toto statement, with the parts of the SLSA v0.2 and v1 provenance predicates that are checked.
+type provenanceStatement struct {
+	Type    string `json:"_type"`
+	Subject []struct {
+		Name   string            `json:"name"`
+		Digest map[string]string `json:"digest"`
+	} `json:"subject"`
+	PredicateType string `json:"predicateType"`
+	Predicate     struct {
+		// SLSA v0.2
+		Builder struct {
+			Id string `json:"id"`
+		} `json:"builder"`
+		Invocation struct {
+			ConfigSource struct {
+				Uri string `json:"uri"`
+			} `json:"configSource"`
+		} `json:"invocation"`
+		// SLSA v1
+		RunDetails struct {
+			Builder struct {
+				Id string `json:"id"`
+			} `json:"builder"`
+		} `json:"runDetails"`
+		BuildDefinition struct {
+			ExternalParameters struct {
+				Workflow struct {
+					Repository string `json:"repository"`
+				} `json:"workflow"`
+			} `json:"externalParameters"`
+			ResolvedDependencies []struct {
+				Uri string `json:"uri"`
+			} `json:"resolvedDependencies"`
+		} `json:"buildDefinition"`
+	} `json:"predicate"`
+}
+
+// Returns the ID of the builder that produced the subjects.
+func (s *provenanceStatement) builderId() string {
+	if s.Predicate.RunDetails.Builder.Id != "" {
+		return s.Predicate.RunDetails.Builder.Id
+	}
+	return s.Predicate.Builder.Id
+}
+
+// Returns the repository the subjects were built from.
+func (s *provenanceStatement) sourceRepository() string {
+	if repository := s.Predicate.BuildDefinition.ExternalParameters.Workflow.Repository; repository != "" {
+		return repository
+	}
+	if s.Predicate.Invocation.ConfigSource.Uri != "" {
+		return s.Predicate.Invocation.ConfigSource.Uri
+	}
+	if dependencies := s.Predicate.BuildDefinition.ResolvedDependencies; len(dependencies) > 0 {
+		return dependencies[0].Uri
+	}
+	return ""
+}
+
+// Returns true if the asset is an in-toto attestation.
+func isProvenanceAsset(name string) bool {
+	return strings.HasSuffix(name, ProvenanceSuffix)
+}
+
+// Parses the statements of an attestation file. Each line is a DSSE envelope, a Sigstore bundle
+// that contains one, or a plain statement. Signatures of the envelopes are not checked: the file
+// is trusted if it was downloaded with a valid signature, or from a trusted source.
+func parseProvenance(data []byte) ([]provenanceStatement, error) {
+	var statements []provenanceStatement
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, maxChecksumFileSize*16)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var envelope struct {
+			PayloadType  string `json:"payloadType"`
+			Payload      string `json:"payload"`
+			DsseEnvelope *struct {
+				PayloadType string `json:"payloadType"`
+				Payload     string `json:"payload"`
+			} `json:"dsseEnvelope"`
+		}
+		if err := json.Unmarshal(line, &envelope); err != nil {
+			return nil, fmt.Errorf("invalid attestation: %v", err)
+		}
+		if envelope.DsseEnvelope != nil {
+			envelope.PayloadType, envelope.Payload = envelope.DsseEnvelope.PayloadType, envelope.DsseEnvelope.Payload
+		}
+		statement := line
+		if envelope.Payload != "" {
+			if envelope.PayloadType != "application/vnd.in-toto+json" {
+				return nil, fmt.Errorf("unsupported attestation payload type '%v'", envelope.PayloadType)
+			}
+			var err error
+			if statement, err = base64.StdEncoding.DecodeString(envelope.Payload); err != nil {
+				return nil, fmt.Errorf("invalid attestation payload: %v", err)
+			}
+		}
+		var s provenanceStatement
+		if err := json.Unmarshal(statement, &s); err != nil {
+			return nil, fmt.Errorf("invalid in-toto statement: %v", err)
+		}
+		if !strings.HasPrefix(s.Type, "https://in-toto.io/Statement/") {
+			return nil, fmt.Errorf("unsupported in-toto statement type '%v'", s.Type)
+		}
+		if !strings.HasPrefix(s.PredicateType, "https://slsa.dev/provenance/") {
+			// Other attestations, such as SBOMs, may be bundled in the same file.
+			continue
+		}
+		statements = append(statements, s)
+	}
+	return statements, scanner.Err()
+}
+
+// Reduces a repository URI such as 'git+https://github.com/project-chip/zap@refs/tags/v2024.03.14'
+// to 'github.com/project-chip/zap', so that the different spellings of provenance versions compare equal.
+func normalizeRepository(uri string) string {
+	uri = strings.TrimPrefix(strings.ToLower(uri), "git+")
+	if _, rest, found := strings.Cut(uri, "://"); found {
+		uri = rest
+	}
+	uri, _, _ = strings.Cut(uri, "@")
+	return strings.TrimSuffix(strings.TrimSuffix(uri, "/"), ".git")
+}
+
+// Returns an error if the statement doesn't satisfy the policy of the repo.
+func (s *provenanceStatement) checkPolicy(cfg *GithubConfiguration) error {
+	policy := cfg.ProvenancePolicy
+	if policy.BuilderId != "" && s.builderId() != policy.BuilderId && !strings.HasPrefix(s.builderId(), policy.BuilderId+"@") {
+		return fmt.Errorf("built by '%v', but the policy requires '%v'", s.builderId(), policy.BuilderId)
+	}
+	source := policy.SourceRepository
+	if source == "" {
+		source = "github.com/" + cfg.Owner + "/" + cfg.Repo
+	}
+	if normalizeRepository(s.sourceRepository()) != normalizeRepository(source) {
+		return fmt.Errorf("built from '%v', but the policy requires '%v'", s.sourceRepository(), source)
+	}
+	return nil
+}
+
+// Verifies the release files in a directory against the SLSA provenance attestations stored next to
+// them. Every file must be a subject of a provenance statement that satisfies the policy of the repo,
+// with a matching SHA-256. Files that don't match are removed. Nothing is downloaded, so this works
+// the same for files from Github and from Artifactory.
+func VerifyProvenance(cfg *GithubConfiguration, directory string) error {
+	if !cfg.VerifyProvenance {
+		return nil
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	type subject struct {
+		sha256    string
+		statement *provenanceStatement
+		source    string
+	}
+	subjects := map[string]subject{}
+	var files []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if isProvenanceAsset(name) {
+			data, err := os.ReadFile(filepath.Join(directory, name))
+			if err != nil {
+				return err
+			}
+			statements, err := parseProvenance(data)
+			if err != nil {
+				return fmt.Errorf("%v: %v", filepath.Join(directory, name), err)
+			}
+			for i := range statements {
+				if err := statements[i].checkPolicy(cfg); err != nil {
+					return fmt.Errorf("provenance %v: %v", filepath.Join(directory, name), err)
+				}
+				for _, s := range statements[i].Subject {
+					if sum := s.Digest["sha256"]; sum != "" {
+						subjects[filepath.Base(s.Name)] = subject{strings.ToLower(sum), &statements[i], name}
+					}
+				}
+			}
+			continue
+		}
+		if entry.IsDir() || signedAssetName(name) != "" || isChecksumAsset(name) || strings.HasPrefix(name, ".") || strings.HasSuffix(name, PartSuffix) || strings.HasSuffix(name, PartMetadataSuffix) {
+			continue
+		}
+		files = append(files, name)
+	}
+	if len(subjects) == 0 {
+		return fmt.Errorf("%v has no SLSA provenance (*%v) to verify the files against", directory, ProvenanceSuffix)
+	}
+	sort.Strings(files)
+	for _, name := range files {
+		path := filepath.Join(directory, name)
+		s, ok := subjects[name]
+		if !ok {
+			return fmt.Errorf("%v is not a subject of the SLSA provenance", path)
+		}
+		hasher := sha256.New()
+		if err := hashFile(hasher, path); err != nil {
+			return err
+		}
+		if actual := hex.EncodeToString(hasher.Sum(nil)); actual != s.sha256 {
+			os.Remove(path)
+			return fmt.Errorf("SHA-256 mismatch for %v: expected %v from %v, got %v, the file was removed", path, s.sha256, s.source, actual)
+		}
+		fmt.Printf("Verified %v against its provenance, which states that it was built by '%v' from '%v' (%v).\n", path, s.statement.builderId(), s.statement.sourceRepository(), s.statement.PredicateType)
+	}
+	return nil
+}
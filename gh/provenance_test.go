@@ -0,0 +1,146 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// SLSA v1 provenance of zap-linux-x64.zip, as produced by slsa-github-generator.
+const slsaV1Statement = `{"_type":"https://in-toto.io/Statement/v1","subject":[{"name":"zap-linux-x64.zip","digest":{"sha256":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}}],` +
+	`"predicateType":"https://slsa.dev/provenance/v1","predicate":{"buildDefinition":{"externalParameters":{"workflow":{"repository":"https://github.com/project-chip/zap","ref":"refs/tags/v2024.03.14"}}},` +
+	`"runDetails":{"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"}}}}`
+
+// SLSA v0.2 provenance of the same file.
+const slsaV02Statement = `{"_type":"https://in-toto.io/Statement/v0.1","subject":[{"name":"zap-linux-x64.zip","digest":{"sha256":"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"}}],` +
+	`"predicateType":"https://slsa.dev/provenance/v0.2","predicate":{"builder":{"id":"https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml@refs/tags/v1.9.0"},` +
+	`"invocation":{"configSource":{"uri":"git+https://github.com/project-chip/zap@refs/tags/v2024.03.14"}}}}`
+
+const slsaBuilderId = "https://github.com/slsa-framework/slsa-github-generator/.github/workflows/generator_generic_slsa3.yml"
+
+// Wraps a statement into a DSSE envelope. The signature is not checked, so it is a dummy.
+func dsseEnvelope(payloadType string, statement string) map[string]interface{} {
+	return map[string]interface{}{
+		"payloadType": payloadType,
+		"payload":     base64.StdEncoding.EncodeToString([]byte(statement)),
+		"signatures":  []map[string]string{{"keyid": "", "sig": "MEUCIQ=="}},
+	}
+}
+
+func jsonLine(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseProvenance(t *testing.T) {
+	sbom := `{"_type":"https://in-toto.io/Statement/v1","subject":[],"predicateType":"https://spdx.dev/Document","predicate":{}}`
+	tests := []struct {
+		name           string
+		data           string
+		wantStatements int
+		wantErr        string
+	}{
+		{"DSSE envelope", jsonLine(t, dsseEnvelope("application/vnd.in-toto+json", slsaV1Statement)), 1, ""},
+		{"Sigstore bundle", jsonLine(t, map[string]interface{}{
+			"mediaType":    "application/vnd.dev.sigstore.bundle+json;version=0.2",
+			"dsseEnvelope": dsseEnvelope("application/vnd.in-toto+json", slsaV02Statement),
+		}), 1, ""},
+		{"plain statement", slsaV02Statement, 1, ""},
+		{"several lines", slsaV1Statement + "\n\n" + jsonLine(t, dsseEnvelope("application/vnd.in-toto+json", slsaV02Statement)) + "\n", 2, ""},
+		{"other predicates are skipped", slsaV1Statement + "\n" + sbom, 1, ""},
+		{"unsupported payload type", jsonLine(t, dsseEnvelope("text/plain", slsaV1Statement)), 0, "unsupported attestation payload type"},
+		{"invalid payload", `{"payloadType":"application/vnd.in-toto+json","payload":"not base64!"}`, 0, "invalid attestation payload"},
+		{"not a statement", `{"_type":"https://example.com/Other"}`, 0, "unsupported in-toto statement type"},
+		{"not JSON", "zap-linux-x64.zip", 0, "invalid attestation"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			statements, err := parseProvenance([]byte(test.data))
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("parseProvenance() error = %v, want an error containing '%v'", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseProvenance() error = %v", err)
+			}
+			if len(statements) != test.wantStatements {
+				t.Fatalf("parseProvenance() returned %v statements, want %v", len(statements), test.wantStatements)
+			}
+			for _, s := range statements {
+				if !strings.HasPrefix(s.builderId(), slsaBuilderId+"@") {
+					t.Errorf("builderId() = %v", s.builderId())
+				}
+				if normalizeRepository(s.sourceRepository()) != "github.com/project-chip/zap" {
+					t.Errorf("sourceRepository() = %v", s.sourceRepository())
+				}
+				if len(s.Subject) != 1 || s.Subject[0].Name != "zap-linux-x64.zip" {
+					t.Errorf("Subject = %v", s.Subject)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckPolicy(t *testing.T) {
+	statements, err := parseProvenance([]byte(slsaV1Statement + "\n" + slsaV02Statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name    string
+		repo    string
+		policy  ProvenancePolicy
+		wantErr bool
+	}{
+		{"repo of the download", "zap", ProvenancePolicy{}, false},
+		{"builder", "zap", ProvenancePolicy{BuilderId: slsaBuilderId}, false},
+		{"other builder", "zap", ProvenancePolicy{BuilderId: "https://example.com/builder"}, true},
+		{"other repo", "connectedhomeip", ProvenancePolicy{}, true},
+		{"source repository", "fork", ProvenancePolicy{SourceRepository: "https://github.com/project-chip/zap.git"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &GithubConfiguration{Owner: "project-chip", Repo: test.repo, ProvenancePolicy: test.policy}
+			for _, s := range statements {
+				if err := s.checkPolicy(cfg); (err != nil) != test.wantErr {
+					t.Errorf("checkPolicy(%v) error = %v, wantErr %v", s.PredicateType, err, test.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func TestVerifyProvenanceWithRequiredSignatures(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		// The SHA-256 of the empty file is in the statement.
+		"zap-linux-x64.zip":                    "",
+		"zap-linux-x64.zip" + ProvenanceSuffix: jsonLine(t, dsseEnvelope("application/vnd.in-toto+json", slsaV1Statement)),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cfg := &GithubConfiguration{Owner: "project-chip", Repo: "zap", VerifyProvenance: true, RequireSignature: true}
+	if err := VerifyProvenance(cfg, directory); err != nil {
+		t.Fatalf("VerifyProvenance() error = %v", err)
+	}
+	// The signatures in the envelope are not checked, so the provenance needs a signature too.
+	os.Remove(filepath.Join(directory, "zap-linux-x64.zip"))
+	err := VerifySignatures(cfg, directory)
+	if err == nil || !strings.Contains(err.Error(), "zap-linux-x64.zip"+ProvenanceSuffix+" has no signature") {
+		t.Fatalf("VerifySignatures() error = %v, want one for the provenance", err)
+	}
+}
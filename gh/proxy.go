@@ -0,0 +1,108 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// Proxy of a rule that connects without a proxy.
+const DirectProxy = "direct"
+
+// ProxyRule selects the proxy for the hosts matching a pattern. Rules are configured in the config
+// file, e.g. "proxies": [ { "host": "artifactory.example.com", "proxy": "direct" }, { "host": "*.github.com", "proxy": "http://proxy:8080" } ].
+type ProxyRule struct {
+	// Host name, '*.example.com' or '.example.com' for a domain and its subdomains, or '*' for every host.
+	Host string `mapstructure:"host"`
+	// Proxy URL, or 'direct' to connect without a proxy.
+	Proxy string `mapstructure:"proxy"`
+}
+
+// Returns true if the rule applies to the host.
+func (r ProxyRule) matches(host string) bool {
+	pattern := strings.ToLower(r.Host)
+	host = strings.ToLower(host)
+	if pattern == "*" || pattern == host {
+		return true
+	}
+	domain := strings.TrimPrefix(strings.TrimPrefix(pattern, "*"), ".")
+	return domain != pattern && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// Parses a proxy URL, which needs a scheme and a host.
+func parseProxyUrl(proxy string) (*url.URL, error) {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL '%v', expected e.g. 'http://proxy.example.com:8080'", proxy)
+	}
+	return u, nil
+}
+
+// Returns the proxy for a URL, or nil for a direct connection. The first matching proxy rule wins.
+// Otherwise the proxy option is used, or the HTTPS_PROXY and HTTP_PROXY environment variables, unless
+// the host is excluded by the no-proxy option or NO_PROXY. Proxies without credentials get the configured ones.
+func (dso *DownloadOptions) ProxyFor(u *url.URL) (*url.URL, error) {
+	proxy, err := dso.selectProxy(u)
+	if err != nil || proxy == nil {
+		return nil, err
+	}
+	if proxy.User == nil && dso.proxyUser != "" {
+		withUser := *proxy
+		withUser.User = url.UserPassword(dso.proxyUser, dso.proxyPassword)
+		proxy = &withUser
+	}
+	return proxy, nil
+}
+
+func (dso *DownloadOptions) selectProxy(u *url.URL) (*url.URL, error) {
+	for _, rule := range dso.proxyRules {
+		if rule.matches(u.Hostname()) {
+			if rule.Proxy == "" || strings.EqualFold(rule.Proxy, DirectProxy) {
+				return nil, nil
+			}
+			return parseProxyUrl(rule.Proxy)
+		}
+	}
+	environment := dso.environment
+	if dso.proxyUrl != nil {
+		environment.HTTPProxy = dso.proxyUrl.String()
+		environment.HTTPSProxy = dso.proxyUrl.String()
+	}
+	if dso.noProxy != "" {
+		environment.NoProxy = dso.noProxy
+	}
+	return environment.ProxyFunc()(u)
+}
+
+// Returns the Proxy function of the transports to Github and Artifactory, which logs the proxy of each request in debug mode.
+func (dso *DownloadOptions) ProxyFunc() func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		proxy, err := dso.ProxyFor(req.URL)
+		if dso.debug {
+			// Signed download URLs carry credentials in their query, so it is left out.
+			target := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+			if err != nil {
+				dso.progress.Printf("Debug: %v %v: invalid proxy: %v\n", req.Method, target, err)
+			} else if proxy == nil {
+				dso.progress.Printf("Debug: %v %v: direct connection\n", req.Method, target)
+			} else {
+				dso.progress.Printf("Debug: %v %v: via proxy %v\n", req.Method, target, proxy.Redacted())
+			}
+		}
+		return proxy, err
+	}
+}
+
+// Takes the proxy environment variables, so that they are read once, the same way for Github and Artifactory.
+func proxyEnvironment() httpproxy.Config {
+	return *httpproxy.FromEnvironment()
+}
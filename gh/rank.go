@@ -0,0 +1,108 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/github"
+)
+
+// AssetPreference ranks the assets that match a platform, so that only the best one is downloaded.
+type AssetPreference struct {
+	// Formats in order of preference, e.g. '.zip', '.tar.gz'. Other formats rank last.
+	Formats []string
+	// Preferred variant, as determined by the platform rules. Empty prefers assets without a variant.
+	Variant string
+	// 'largest' or 'smallest' to break the remaining ties by size. Otherwise the release order decides.
+	Size string
+}
+
+// Default format preference: portable archives first, then installers and packages.
+var DefaultFormats = []string{".zip", ".tar.gz", ".tgz", ".tar.xz", ".dmg", ".exe", ".msi", ".deb", ".rpm", ".AppImage"}
+
+// Returns the index of the format of an asset in the preference list, or the length of the list
+// if the format is not in it, together with the format itself.
+func (pref *AssetPreference) format(name string) (int, string) {
+	best, bestFormat := len(pref.Formats), ""
+	for i, format := range pref.Formats {
+		// The longest matching format wins, so that '.tar.gz' is not mistaken for '.gz'.
+		if strings.HasSuffix(strings.ToLower(name), strings.ToLower(format)) && len(format) > len(bestFormat) {
+			best, bestFormat = i, format
+		}
+	}
+	if bestFormat == "" {
+		bestFormat = filepath.Ext(name)
+		if strings.HasSuffix(strings.TrimSuffix(name, bestFormat), ".tar") {
+			bestFormat = ".tar" + bestFormat
+		}
+	}
+	return best, bestFormat
+}
+
+type rankedAsset struct {
+	asset    *github.ReleaseAsset
+	platform AssetPlatform
+	format   string
+	// Sort key, compared element by element. Lower is better.
+	key []int64
+}
+
+// Ranks the assets according to the preference, best first. Platform specific assets rank
+// before platform independent ones, then the preferred variant, format and size decide.
+func (pref *AssetPreference) rank(pc *PlatformClassifier, assets []*github.ReleaseAsset) []rankedAsset {
+	ranked := make([]rankedAsset, len(assets))
+	for i, asset := range assets {
+		p := pc.DetermineAssetPlatform(asset.GetName())
+		formatIndex, format := pref.format(asset.GetName())
+		r := rankedAsset{asset: asset, platform: p, format: format}
+		r.key = append(r.key, boolRank(p.OS != ""), boolRank(strings.EqualFold(p.Variant, pref.Variant)), int64(formatIndex))
+		switch pref.Size {
+		case "largest":
+			r.key = append(r.key, -int64(asset.GetSize()))
+		case "smallest":
+			r.key = append(r.key, int64(asset.GetSize()))
+		}
+		ranked[i] = r
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		for k := range ranked[i].key {
+			if ranked[i].key[k] != ranked[j].key[k] {
+				return ranked[i].key[k] < ranked[j].key[k]
+			}
+		}
+		return false
+	})
+	return ranked
+}
+
+func boolRank(preferred bool) int64 {
+	if preferred {
+		return 0
+	}
+	return 1
+}
+
+// Picks the best of the assets selected for a platform. In a dry run, the whole ranking is printed.
+func pickAsset(cfg *GithubConfiguration, target Platform, selected []*github.ReleaseAsset) ([]*github.ReleaseAsset, error) {
+	if size := cfg.Preference.Size; size != "" && size != "largest" && size != "smallest" {
+		return nil, fmt.Errorf("invalid size preference '%v', use 'largest' or 'smallest'", size)
+	}
+	pc, err := NewPlatformClassifier(cfg.PlatformRules)
+	if err != nil {
+		return nil, err
+	}
+	ranked := cfg.Preference.rank(pc, selected)
+	if cfg.DryRun {
+		fmt.Printf("Ranking of assets for platform '%v' [formats: %v, variant: '%v', size: '%v']:\n", target, strings.Join(cfg.Preference.Formats, " "), cfg.Preference.Variant, cfg.Preference.Size)
+		for i, r := range ranked {
+			fmt.Printf("  %v. %v [format: %v, variant: '%v', %v bytes]\n", i+1, r.asset.GetName(), r.format, r.platform.Variant, r.asset.GetSize())
+		}
+	}
+	fmt.Printf("Selected asset '%v' for platform '%v'.\n", ranked[0].asset.GetName(), target)
+	return []*github.ReleaseAsset{ranked[0].asset}, nil
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Below this many remaining API requests, a warning is printed.
+const lowRateLimit = 10
+
+// Github resets the quota every hour, so a reset that is further away means that the clocks differ.
+// Waiting is capped there, after which the request is repeated.
+const maxRateLimitWait = time.Hour
+
+// Margin for clock differences between us and Github.
+const rateLimitWaitMargin = time.Second
+
+// Keeps track of the Github API quota, as reported with every response.
+type rateTracker struct {
+	mu     sync.Mutex
+	rate   github.Rate
+	warned bool
+}
+
+// Records the quota reported by a response, and warns once when it is running low.
+func (c *GithubClient) trackRate(resp *github.Response) {
+	if resp == nil || resp.Rate.Limit == 0 {
+		return
+	}
+	c.rate.mu.Lock()
+	defer c.rate.mu.Unlock()
+	c.rate.rate = resp.Rate
+	if resp.Rate.Remaining < lowRateLimit && !c.rate.warned {
+		c.rate.warned = true
+		c.out.Printf("Warning: only %v of %v Github API requests left until %v.\n", resp.Rate.Remaining, resp.Rate.Limit, formatReset(resp.Rate))
+	}
+}
+
+// Returns the Github API quota as last reported by Github.
+func (c *GithubClient) RateLimit() github.Rate {
+	c.rate.mu.Lock()
+	defer c.rate.mu.Unlock()
+	return c.rate.rate
+}
+
+// Handles an exhausted API quota. With --waitForRateLimit, waits until the quota is reset and returns nil,
+// so that the request can be repeated. Otherwise returns an error that tells when the quota is reset.
+func (c *GithubClient) waitForReset(ctx context.Context, what string, err *github.RateLimitError) error {
+	if !c.waitForRateLimit {
+		return fmt.Errorf("the Github API rate limit of %v requests per hour is exhausted until %v. Use --ghToken for a higher limit, or --waitForRateLimit to wait for the reset", err.Rate.Limit, formatReset(err.Rate))
+	}
+	now := time.Now()
+	delay := rateLimitWait(err.Rate.Reset.Time, now)
+	if err.Rate.Reset.Time.Sub(now) >= maxRateLimitWait {
+		c.out.Printf("The Github API rate limit is exhausted while %v, until %v. Waiting %v before trying again ...\n", what, formatReset(err.Rate), delay)
+	} else {
+		c.out.Printf("The Github API rate limit is exhausted while %v. Waiting %v until %v for the reset ...\n", what, delay.Round(time.Second), formatReset(err.Rate))
+	}
+	return sleep(ctx, delay)
+}
+
+// Returns how long to wait at now for a quota that is reset at reset, at most maxRateLimitWait.
+func rateLimitWait(reset time.Time, now time.Time) time.Duration {
+	delay := reset.Sub(now)
+	if delay < 0 {
+		delay = 0
+	}
+	delay += rateLimitWaitMargin
+	if delay > maxRateLimitWait {
+		delay = maxRateLimitWait
+	}
+	return delay
+}
+
+func formatReset(rate github.Rate) string {
+	return rate.Reset.Time.Local().Format("15:04:05 MST")
+}
@@ -0,0 +1,119 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestRateLimitWait(t *testing.T) {
+	now := time.Date(2024, 4, 2, 9, 15, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		reset time.Time
+		want  time.Duration
+	}{
+		{"reset ahead", now.Add(10 * time.Minute), 10*time.Minute + rateLimitWaitMargin},
+		{"reset now", now, rateLimitWaitMargin},
+		{"reset passed", now.Add(-time.Minute), rateLimitWaitMargin},
+		{"reset at the cap", now.Add(maxRateLimitWait - rateLimitWaitMargin), maxRateLimitWait},
+		{"reset beyond the cap", now.Add(5 * time.Hour), maxRateLimitWait},
+	}
+	for _, test := range tests {
+		if got := rateLimitWait(test.reset, now); got != test.want {
+			t.Errorf("rateLimitWait() with %v = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// Returns the error of a request that exhausted the quota, which is reset after the delay.
+func rateLimitError(reset time.Duration) *github.RateLimitError {
+	request, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/project-chip/zap/releases", nil)
+	return &github.RateLimitError{
+		Rate:     github.Rate{Limit: 60, Remaining: 0, Reset: github.Timestamp{Time: time.Now().Add(reset)}},
+		Response: &http.Response{StatusCode: http.StatusForbidden, Request: request},
+		Message:  "API rate limit exceeded",
+	}
+}
+
+func TestWaitForReset(t *testing.T) {
+	tests := []struct {
+		name     string
+		wait     bool
+		reset    time.Duration
+		wantErr  string
+		minDelay time.Duration
+		maxDelay time.Duration
+	}{
+		{"fail fast", false, 10 * time.Minute, "--waitForRateLimit", 0, 0},
+		{"wait for the reset", true, 10 * time.Minute, "", 9 * time.Minute, 10*time.Minute + rateLimitWaitMargin},
+		{"wait is capped", true, 3 * time.Hour, "", maxRateLimitWait, maxRateLimitWait},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delays := fakeSleep(t)
+			c := &GithubClient{waitForRateLimit: test.wait}
+			attempts := 0
+			err := c.withRetry(context.Background(), "testing", func() (*github.Response, error) {
+				attempts++
+				if attempts == 1 {
+					return nil, rateLimitError(test.reset)
+				}
+				return nil, nil
+			})
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("withRetry() error = %v, want one containing '%v'", err, test.wantErr)
+				}
+				if attempts != 1 || len(*delays) != 0 {
+					t.Errorf("withRetry() made %v attempts and waited %v, want 1 attempt without waiting", attempts, *delays)
+				}
+				return
+			}
+			// Waiting for the reset is not a retry, so it happens even with retries disabled.
+			if err != nil || attempts != 2 {
+				t.Fatalf("withRetry() made %v attempts with error %v, want 2 without error", attempts, err)
+			}
+			if len(*delays) != 1 || (*delays)[0] < test.minDelay || (*delays)[0] > test.maxDelay {
+				t.Errorf("withRetry() waited %v, want between %v and %v", *delays, test.minDelay, test.maxDelay)
+			}
+		})
+	}
+}
+
+func TestWaitForResetCanceled(t *testing.T) {
+	fakeSleep(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c := &GithubClient{waitForRateLimit: true}
+	if err := c.waitForReset(ctx, "testing", rateLimitError(time.Minute)); !errors.Is(err, context.Canceled) {
+		t.Errorf("waitForReset() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestTrackRate(t *testing.T) {
+	c := &GithubClient{}
+	c.trackRate(nil)
+	// Responses from the cache or from asset downloads have no quota.
+	c.trackRate(&github.Response{})
+	if c.RateLimit().Limit != 0 || c.rate.warned {
+		t.Fatalf("trackRate() recorded %+v without a quota", c.RateLimit())
+	}
+	reset := github.Timestamp{Time: time.Now().Add(time.Hour)}
+	c.trackRate(&github.Response{Rate: github.Rate{Limit: 60, Remaining: 42, Reset: reset}})
+	if c.RateLimit().Remaining != 42 || c.rate.warned {
+		t.Fatalf("RateLimit() = %+v, warned %v", c.RateLimit(), c.rate.warned)
+	}
+	c.trackRate(&github.Response{Rate: github.Rate{Limit: 60, Remaining: lowRateLimit - 1, Reset: reset}})
+	if c.RateLimit().Remaining != lowRateLimit-1 || !c.rate.warned {
+		t.Fatalf("RateLimit() = %+v, warned %v, want a warning", c.RateLimit(), c.rate.warned)
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/github"
+	"github.com/spf13/cobra"
+)
+
+// Resolves the configured release into a concrete Github release. The release can be
+// 'latest', a version constraint, or an exact tag. 'latest' and version constraints only
+// consider releases of the configured channel, published within the configured dates.
+// Returns nil if nothing matches.
+func ResolveRelease(ctx context.Context, client *GithubClient, cfg *GithubConfiguration) *github.RepositoryRelease {
+	if cfg.Release != "latest" && !IsVersionConstraint(cfg.Release) {
+		return findRelease(ctx, client, cfg.Owner, cfg.Repo, cfg.Release)
+	}
+	if !cfg.NeedsResolution() {
+		// Without a channel or dates, we rely on Github's notion of the latest release.
+		var release *github.RepositoryRelease
+		err := client.withRetry(ctx, "looking up the latest release", func() (*github.Response, error) {
+			var resp *github.Response
+			var err error
+			release, resp, err = client.Repositories.GetLatestRelease(ctx, cfg.Owner, cfg.Repo)
+			return resp, err
+		})
+		cobra.CheckErr(err)
+		return release
+	}
+	filter, err := newReleaseFilter(cfg)
+	cobra.CheckErr(err)
+	candidates := filter.apply(listReleases(ctx, client, cfg.Owner, cfg.Repo, 0, MaxPageSize))
+	if cfg.Release == "latest" {
+		return newestRelease(candidates)
+	}
+	constraint, err := ParseVersionConstraint(cfg.Release)
+	cobra.CheckErr(err)
+	var best *github.RepositoryRelease
+	var bestVersion *Version
+	for _, release := range candidates {
+		v, err := ParseVersion(release.GetTagName())
+		if err != nil || !constraint.Matches(v) {
+			continue
+		}
+		if best == nil || v.Compare(bestVersion) > 0 {
+			best = release
+			bestVersion = v
+		}
+	}
+	return best
+}
+
+// Returns true if a channel or publishing dates restrict which releases are considered.
+func (cfg *GithubConfiguration) filtersReleases() bool {
+	return cfg.Channel != "" || !cfg.ReleasedBefore.IsZero() || !cfg.ReleasedAfter.IsZero()
+}
+
+// Returns true if the configured release is selected from the list of releases, rather
+// than being an exact tag, 'all', or Github's latest release.
+func (cfg *GithubConfiguration) NeedsResolution() bool {
+	return IsVersionConstraint(cfg.Release) || (cfg.Release == "latest" && cfg.filtersReleases())
+}
+
+// Returns the most recently published release, or nil if there are none.
+func newestRelease(releases []*github.RepositoryRelease) *github.RepositoryRelease {
+	var newest *github.RepositoryRelease
+	for _, release := range releases {
+		if newest == nil || release.GetPublishedAt().After(newest.GetPublishedAt().Time) {
+			newest = release
+		}
+	}
+	return newest
+}
+
+// Resolves the configured release and returns its tag, or an empty string if no release matches.
+func ResolveReleaseTag(ctx context.Context, client *GithubClient, cfg *GithubConfiguration) string {
+	return ResolveRelease(ctx, client, cfg).GetTagName()
+}
+
+// Resolves the releases to download for the 'all' release. To keep downloads bounded, at least
+// one of the last releases count, the publishing dates, the version range or the channel must
+// be set. Releases are returned newest first.
+func ResolveReleases(ctx context.Context, client *GithubClient, cfg *GithubConfiguration) ([]*github.RepositoryRelease, error) {
+	if cfg.Last <= 0 && cfg.VersionRange == "" && !cfg.filtersReleases() {
+		return nil, fmt.Errorf("downloading all releases needs a bound: use --last, --releasedBefore, --releasedAfter, --versionRange or --channel")
+	}
+	releases, err := filterReleases(cfg, listReleases(ctx, client, cfg.Owner, cfg.Repo, 0, MaxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(releases, func(i, j int) bool {
+		return releases[i].GetPublishedAt().After(releases[j].GetPublishedAt().Time)
+	})
+	if cfg.Last > 0 && len(releases) > cfg.Last {
+		releases = releases[:cfg.Last]
+	}
+	return releases, nil
+}
+
+// Returns the releases that match the configured channel, publishing dates and version range.
+func filterReleases(cfg *GithubConfiguration, releases []*github.RepositoryRelease) ([]*github.RepositoryRelease, error) {
+	filter, err := newReleaseFilter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	releases = filter.apply(releases)
+	if cfg.VersionRange == "" {
+		return releases, nil
+	}
+	constraint, err := ParseVersionConstraint(cfg.VersionRange)
+	if err != nil {
+		return nil, err
+	}
+	var matching []*github.RepositoryRelease
+	for _, release := range releases {
+		if v, err := ParseVersion(release.GetTagName()); err == nil && constraint.Matches(v) {
+			matching = append(matching, release)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Suffix of files that are still being downloaded.
+const PartSuffix = ".part"
+
+// Suffix of the metadata that is kept next to a .part file, so that the download can be resumed.
+const PartMetadataSuffix = ".part.json"
+
+// Describes a partial download, written next to the .part file.
+type partMetadata struct {
+	// URL the download was started from. Github redirects to signed URLs that change
+	// on every request, so it is informational only: the ETag decides if we can resume.
+	Url string `json:"url"`
+	// ETag of the file, sent in If-Range when resuming.
+	ETag string `json:"etag"`
+	// Expected size of the complete file.
+	Size int64 `json:"size"`
+}
+
+// Returns the metadata of a partial download and the number of bytes already downloaded.
+// Returns nil if there is nothing that can be resumed.
+func readPartMetadata(path string) (*partMetadata, int64) {
+	info, err := os.Stat(path + PartSuffix)
+	if err != nil || info.Size() == 0 {
+		return nil, 0
+	}
+	data, err := os.ReadFile(path + PartMetadataSuffix)
+	if err != nil {
+		return nil, 0
+	}
+	meta := &partMetadata{}
+	if err := json.Unmarshal(data, meta); err != nil || meta.ETag == "" || info.Size() >= meta.Size {
+		return nil, 0
+	}
+	return meta, info.Size()
+}
+
+func writePartMetadata(path string, meta *partMetadata) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+PartMetadataSuffix, data, 0664)
+}
+
+// Removes the .part file and its metadata.
+func removePart(path string) {
+	os.Remove(path + PartSuffix)
+	os.Remove(path + PartMetadataSuffix)
+}
+
+// Returns true if a response to a full download allows resuming it later with a Range request.
+func isResumable(response *http.Response) bool {
+	return response.Header.Get("Accept-Ranges") == "bytes" && response.Header.Get("ETag") != "" && response.ContentLength > 0
+}
+
+// Returns the first byte of a 206 response, from its 'Content-Range: bytes start-end/size' header.
+func contentRangeStart(response *http.Response) (int64, error) {
+	value := strings.TrimPrefix(response.Header.Get("Content-Range"), "bytes ")
+	start, _, found := strings.Cut(value, "-")
+	if !found {
+		return 0, fmt.Errorf("invalid Content-Range: '%v'", response.Header.Get("Content-Range"))
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
@@ -0,0 +1,245 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A server for one asset, which records the Range and If-Range headers of each request.
+type assetServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []string
+}
+
+func newAssetServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) *assetServer {
+	s := &assetServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Header.Get("Range")+" "+r.Header.Get("If-Range"))
+		s.mu.Unlock()
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Serves content with Range and If-Range support, like Github's asset storage.
+func serveResumable(content []byte, etag string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}
+}
+
+// Serves content in full, ignoring Range.
+func serveFull(content []byte) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}
+}
+
+// Returns size bytes of content that differs for each seed.
+func testContent(size int, seed byte) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i*7) + seed
+	}
+	return content
+}
+
+func downloadTestAsset(t *testing.T, server *assetServer, directory string, content []byte) error {
+	sec := DefaultSecurityOptions()
+	sec.SetAllowHttp(true)
+	sum := sha256.Sum256(content)
+	expected := &expectedChecksum{size: int64(len(content)), sha256: hex.EncodeToString(sum[:]), source: "test"}
+	return downloadFileFromUrl(context.Background(), server.Client(), server.URL+"/asset.zip", directory, "asset.zip", expected, sec, nil)
+}
+
+func TestResumeDownload(t *testing.T) {
+	content := testContent(100000, 0)
+	const offset = 40000
+	tests := []struct {
+		name string
+		// What an earlier run downloaded, and the ETag it saw.
+		part     []byte
+		partETag string
+		handler  func(w http.ResponseWriter, r *http.Request)
+		// Range and If-Range headers of the expected requests.
+		wantRequests []string
+	}{
+		{
+			name:         "resumed with 206",
+			part:         content[:offset],
+			partETag:     `"v1"`,
+			handler:      serveResumable(content, `"v1"`),
+			wantRequests: []string{`bytes=40000- "v1"`},
+		},
+		{
+			name:         "file changed, 200",
+			part:         testContent(offset, 1),
+			partETag:     `"v1"`,
+			handler:      serveResumable(content, `"v2"`),
+			wantRequests: []string{`bytes=40000- "v1"`},
+		},
+		{
+			name:     "Content-Range doesn't start at the offset",
+			part:     content[:offset],
+			partETag: `"v1"`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					w.Header().Set("Content-Range", "bytes 0-99999/100000")
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write(content)
+					return
+				}
+				serveResumable(content, `"v1"`)(w, r)
+			},
+			wantRequests: []string{`bytes=40000- "v1"`, " "},
+		},
+		{
+			name:     "range not satisfiable",
+			part:     content[:offset],
+			partETag: `"v1"`,
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") != "" {
+					w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+					return
+				}
+				serveResumable(content, `"v1"`)(w, r)
+			},
+			wantRequests: []string{`bytes=40000- "v1"`, " "},
+		},
+		{
+			name:         "server can't resume",
+			part:         content[:offset],
+			partETag:     `"v1"`,
+			handler:      serveFull(content),
+			wantRequests: []string{`bytes=40000- "v1"`},
+		},
+		{
+			name:         "nothing to resume",
+			handler:      serveResumable(content, `"v1"`),
+			wantRequests: []string{" "},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "asset.zip")
+			if test.part != nil {
+				os.WriteFile(path+PartSuffix, test.part, 0664)
+				writePartMetadata(path, &partMetadata{ETag: test.partETag, Size: int64(len(content))})
+			}
+			server := newAssetServer(t, test.handler)
+			if err := downloadTestAsset(t, server, directory, content); err != nil {
+				t.Fatalf("download error = %v", err)
+			}
+			if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+				t.Errorf("downloaded %v bytes that differ from the asset", len(data))
+			}
+			if strings.Join(server.requests, "|") != strings.Join(test.wantRequests, "|") {
+				t.Errorf("requests = %q, want %q", server.requests, test.wantRequests)
+			}
+			for _, suffix := range []string{PartSuffix, PartMetadataSuffix} {
+				if _, err := os.Stat(path + suffix); err == nil {
+					t.Errorf("%v was kept", suffix)
+				}
+			}
+		})
+	}
+}
+
+// Sends the first half of the content and drops the connection.
+func serveInterrupted(content []byte, resumable bool) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if resumable {
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Accept-Ranges", "bytes")
+		}
+		w.Header().Set("Content-Length", "100000")
+		w.Write(content[:len(content)/2])
+		w.(http.Flusher).Flush()
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func TestInterruptedDownload(t *testing.T) {
+	content := testContent(100000, 0)
+	tests := []struct {
+		name      string
+		resumable bool
+	}{
+		{"resumable", true},
+		{"not resumable", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "asset.zip")
+			server := newAssetServer(t, serveInterrupted(content, test.resumable))
+			if err := downloadTestAsset(t, server, directory, content); err == nil {
+				t.Fatal("interrupted download succeeded")
+			}
+			if _, err := os.Stat(path); err == nil {
+				t.Error("the incomplete download was renamed into place")
+			}
+			meta, offset := readPartMetadata(path)
+			if !test.resumable {
+				if _, err := os.Stat(path + PartSuffix); err == nil {
+					t.Error("the .part file of a download that can't be resumed was kept")
+				}
+				return
+			}
+			if meta == nil || meta.ETag != `"v1"` || meta.Size != int64(len(content)) || offset == 0 {
+				t.Fatalf("metadata = %+v at offset %v, want a resumable download", meta, offset)
+			}
+			// The next run continues where this one stopped.
+			server = newAssetServer(t, serveResumable(content, `"v1"`))
+			if err := downloadTestAsset(t, server, directory, content); err != nil {
+				t.Fatalf("resumed download error = %v", err)
+			}
+			if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+				t.Errorf("resumed download has %v bytes that differ from the asset", len(data))
+			}
+			if want := fmt.Sprintf(`bytes=%v- "v1"`, offset); len(server.requests) != 1 || server.requests[0] != want {
+				t.Errorf("requests = %q, want %q", server.requests, want)
+			}
+		})
+	}
+}
+
+func TestContentRangeStart(t *testing.T) {
+	tests := []struct {
+		header  string
+		want    int64
+		wantErr bool
+	}{
+		{"bytes 40000-99999/100000", 40000, false},
+		{"bytes 0-0/*", 0, false},
+		{"bytes */100000", 0, true},
+		{"", 0, true},
+		{"bytes x-99999/100000", 0, true},
+	}
+	for _, test := range tests {
+		response := &http.Response{Header: http.Header{"Content-Range": {test.header}}}
+		start, err := contentRangeStart(response)
+		if (err != nil) != test.wantErr || (err == nil && start != test.want) {
+			t.Errorf("contentRangeStart(%v) = %v, %v, want %v, error %v", test.header, start, err, test.want, test.wantErr)
+		}
+	}
+}
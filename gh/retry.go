@@ -0,0 +1,179 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"silabs/get-zap/progress"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// RetryPolicy configures how often and how fast failed Github requests and asset transfers are retried.
+// Only GET requests are made, so every request can safely be repeated.
+type RetryPolicy struct {
+	// Number of retries after the first attempt. 0 disables retrying.
+	Retries int
+	// Delay before the first retry. It doubles with every further retry, up to MaxDelay.
+	Delay time.Duration
+	// Upper bound of the delay between two attempts.
+	MaxDelay time.Duration
+}
+
+// Default upper bound of the delay between two attempts.
+const DefaultMaxRetryDelay = 30 * time.Second
+
+// Error for a response with an unexpected HTTP status.
+type httpStatusError struct {
+	StatusCode int
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP error: %v", e.StatusCode)
+}
+
+// Wraps the Github client together with the settings that apply to all of its requests.
+type GithubClient struct {
+	*github.Client
+	retry RetryPolicy
+	// If true, requests wait for an exhausted rate limit to reset, instead of failing.
+	waitForRateLimit bool
+	rate             rateTracker
+	// Prints retries and rate limit warnings, which may happen while downloads are in progress.
+	out *progress.Reporter
+}
+
+// Calls fn until it succeeds, fails with an error that is not worth retrying, or runs out of retries.
+// The description of the request is used in the log line that is printed for each retry. The rate
+// limit reported with each response is tracked, and an exhausted rate limit is handled by waitForReset.
+func (c *GithubClient) withRetry(ctx context.Context, what string, fn func() (*github.Response, error)) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := fn()
+		c.trackRate(resp)
+		if err == nil {
+			return nil
+		}
+		var rateErr *github.RateLimitError
+		if errors.As(err, &rateErr) {
+			if err := c.waitForReset(ctx, what, rateErr); err != nil {
+				return err
+			}
+			// Waiting for the quota does not count as a retry.
+			attempt--
+			continue
+		}
+		retryAfter, retryable := isRetryable(err)
+		if !retryable || attempt >= c.retry.Retries || ctx.Err() != nil {
+			return err
+		}
+		delay := c.retry.backoff(attempt)
+		if retryAfter > delay {
+			delay = retryAfter
+		}
+		c.out.Printf("Retrying %v in %v (retry %v of %v): %v\n", what, delay.Round(time.Millisecond), attempt+1, c.retry.Retries, err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// Waits for the delay, or until ctx is done. Tests replace it, so that they don't have to wait.
+var sleep = func(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Returns the delay before the given retry: exponential in the attempt, with jitter so that
+// parallel downloads that fail together don't retry in lockstep.
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DefaultMaxRetryDelay
+	}
+	delay := p.Delay
+	for i := 0; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	// Somewhere between half and all of the delay.
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// Returns true if the error is transient: a server error, a dropped connection or a secondary
+// rate limit. For secondary rate limits, also returns how long Github asked us to wait.
+func isRetryable(err error) (time.Duration, bool) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return 0, false
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return abuseErr.GetRetryAfter(), true
+	}
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		// The primary rate limit only resets after up to an hour, retrying won't help.
+		return 0, false
+	}
+	var responseErr *github.ErrorResponse
+	if errors.As(err, &responseErr) && responseErr.Response != nil {
+		// go-github only recognizes the abuse rate limit by its old documentation URL. Newer
+		// secondary rate limit responses are recognized by their Retry-After header or message.
+		if delay := retryAfter(responseErr.Response); delay > 0 || strings.Contains(responseErr.Message, "secondary rate limit") {
+			return delay, true
+		}
+		return 0, isRetryableStatus(responseErr.Response.StatusCode)
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return 0, isRetryableStatus(statusErr.StatusCode)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return 0, true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return 0, true
+	}
+	return 0, false
+}
+
+// Returns the delay requested by the Retry-After header of a response, given in seconds or as a date.
+func retryAfter(response *http.Response) time.Duration {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+func isRetryableStatus(statusCode int) bool {
+	return statusCode >= http.StatusInternalServerError || statusCode == http.StatusTooManyRequests
+}
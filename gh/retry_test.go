@@ -0,0 +1,189 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+// Replaces sleep for the duration of a test, and returns the delays that were slept.
+func fakeSleep(t *testing.T) *[]time.Duration {
+	var delays []time.Duration
+	original := sleep
+	sleep = func(ctx context.Context, delay time.Duration) error {
+		delays = append(delays, delay)
+		return ctx.Err()
+	}
+	t.Cleanup(func() { sleep = original })
+	return &delays
+}
+
+// Returns the error of a Github API response with the given status, headers and message.
+func githubError(statusCode int, header http.Header, message string) error {
+	request, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/project-chip/zap/releases", nil)
+	return &github.ErrorResponse{Response: &http.Response{StatusCode: statusCode, Header: header, Request: request}, Message: message}
+}
+
+// Returns the error of a Github API response that asks to retry after a delay.
+func abuseError(retryAfter *time.Duration) error {
+	request, _ := http.NewRequest(http.MethodGet, "https://api.github.com/repos/project-chip/zap/releases", nil)
+	return &github.AbuseRateLimitError{Response: &http.Response{StatusCode: 403, Request: request}, RetryAfter: retryAfter}
+}
+
+func TestIsRetryable(t *testing.T) {
+	abuseDelay := 42 * time.Second
+	tests := []struct {
+		name      string
+		err       error
+		want      bool
+		wantDelay time.Duration
+	}{
+		{"502 of a download", &httpStatusError{StatusCode: 502}, true, 0},
+		{"500 of a download", &httpStatusError{StatusCode: 500}, true, 0},
+		{"429 of a download", &httpStatusError{StatusCode: 429}, true, 0},
+		{"404 of a download", &httpStatusError{StatusCode: 404}, false, 0},
+		{"502 of the API", githubError(502, http.Header{}, "Bad Gateway"), true, 0},
+		{"429 of the API", githubError(429, http.Header{}, "Too Many Requests"), true, 0},
+		{"403 of the API", githubError(403, http.Header{}, "Resource not accessible"), false, 0},
+		{"404 of the API", githubError(404, http.Header{}, "Not Found"), false, 0},
+		{"abuse rate limit", abuseError(&abuseDelay), true, abuseDelay},
+		{"abuse rate limit without Retry-After", abuseError(nil), true, 0},
+		{"Retry-After", githubError(403, http.Header{"Retry-After": {"30"}}, "slow down"), true, 30 * time.Second},
+		{"secondary rate limit message", githubError(403, http.Header{}, "You have exceeded a secondary rate limit. Please wait a few minutes before you try again."), true, 0},
+		{"primary rate limit", &github.RateLimitError{Message: "API rate limit exceeded"}, false, 0},
+		{"wrapped rate limit", fmt.Errorf("listing releases: %w", &github.RateLimitError{}), false, 0},
+		{"canceled", fmt.Errorf("get: %w", context.Canceled), false, 0},
+		{"deadline", context.DeadlineExceeded, false, 0},
+		{"unexpected EOF", fmt.Errorf("download interrupted: %w", io.ErrUnexpectedEOF), true, 0},
+		{"connection reset", &net.OpError{Op: "read", Err: syscall.ECONNRESET}, true, 0},
+		{"connection refused", &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}, true, 0},
+		{"timeout", &net.DNSError{Err: "timeout", IsTimeout: true}, true, 0},
+		{"unknown host", &net.DNSError{Err: "no such host", IsNotFound: true}, false, 0},
+		{"other error", errors.New("invalid checksum"), false, 0},
+	}
+	for _, test := range tests {
+		delay, got := isRetryable(test.err)
+		if got != test.want || delay != test.wantDelay {
+			t.Errorf("isRetryable(%v) = %v, %v, want %v, %v", test.name, delay, got, test.wantDelay, test.want)
+		}
+	}
+}
+
+func TestRetryAfterDate(t *testing.T) {
+	date := time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat)
+	delay := retryAfter(&http.Response{Header: http.Header{"Retry-After": {date}}})
+	if delay < time.Minute || delay > 2*time.Minute {
+		t.Errorf("retryAfter(%v) = %v, want about 2 minutes", date, delay)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{Delay: time.Second, MaxDelay: 5 * time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{0, time.Second},
+		{1, 2 * time.Second},
+		{2, 4 * time.Second},
+		{3, 5 * time.Second},
+		{100, 5 * time.Second},
+	}
+	for _, test := range tests {
+		// The jitter picks a delay between half and all of the exponential one.
+		for i := 0; i < 20; i++ {
+			if delay := policy.backoff(test.attempt); delay < test.max/2 || delay > test.max {
+				t.Errorf("backoff(%v) = %v, want between %v and %v", test.attempt, delay, test.max/2, test.max)
+			}
+		}
+	}
+	if delay := (RetryPolicy{}).backoff(3); delay != 0 {
+		t.Errorf("backoff() without a delay = %v", delay)
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	abuseDelay := time.Minute
+	tests := []struct {
+		name string
+		// Errors of the attempts, the ones after the last are nil.
+		errs         []error
+		wantErr      bool
+		wantAttempts int
+		wantDelays   []time.Duration
+	}{
+		{"success", nil, false, 1, nil},
+		{"recovers", []error{&httpStatusError{StatusCode: 502}, githubError(503, http.Header{}, "")}, false, 3, []time.Duration{time.Second, 2 * time.Second}},
+		{"out of retries", []error{&httpStatusError{StatusCode: 502}, &httpStatusError{StatusCode: 502}, &httpStatusError{StatusCode: 502}, &httpStatusError{StatusCode: 502}, nil}, true, 4, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+		{"not retryable", []error{githubError(404, http.Header{}, "Not Found"), nil}, true, 1, nil},
+		{"Retry-After of the abuse rate limit", []error{abuseError(&abuseDelay)}, false, 2, []time.Duration{abuseDelay}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			delays := fakeSleep(t)
+			c := &GithubClient{retry: RetryPolicy{Retries: 3, Delay: time.Second}}
+			attempts := 0
+			err := c.withRetry(context.Background(), "testing", func() (*github.Response, error) {
+				attempts++
+				if attempts <= len(test.errs) {
+					return nil, test.errs[attempts-1]
+				}
+				return nil, nil
+			})
+			if (err != nil) != test.wantErr {
+				t.Errorf("withRetry() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("withRetry() made %v attempts, want %v", attempts, test.wantAttempts)
+			}
+			if len(*delays) != len(test.wantDelays) {
+				t.Fatalf("withRetry() waited %v, want %v", *delays, test.wantDelays)
+			}
+			for i, delay := range *delays {
+				// Backoff delays are jittered down to half, Retry-After is waited in full.
+				if delay < test.wantDelays[i]/2 || delay > test.wantDelays[i] {
+					t.Errorf("delay %v = %v, want up to %v", i, delay, test.wantDelays[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWithRetryCanceled(t *testing.T) {
+	c := &GithubClient{retry: RetryPolicy{Retries: 3, Delay: time.Hour}}
+
+	// Canceled while the request is made.
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	err := c.withRetry(ctx, "testing", func() (*github.Response, error) {
+		attempts++
+		cancel()
+		return nil, &httpStatusError{StatusCode: 502}
+	})
+	if attempts != 1 || err == nil {
+		t.Errorf("withRetry() made %v attempts with error %v, want 1 attempt", attempts, err)
+	}
+
+	// Canceled while waiting for the retry.
+	ctx, cancel = context.WithCancel(context.Background())
+	attempts = 0
+	err = c.withRetry(ctx, "testing", func() (*github.Response, error) {
+		attempts++
+		time.AfterFunc(10*time.Millisecond, cancel)
+		return nil, &httpStatusError{StatusCode: 502}
+	})
+	if attempts != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("withRetry() made %v attempts with error %v, want 1 attempt and context.Canceled", attempts, err)
+	}
+}
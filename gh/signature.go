@@ -0,0 +1,298 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/go-github/github"
+	"golang.org/x/crypto/blake2b"
+)
+
+// SigningKey is a public key that release assets of a repo are signed with. It is configured
+// per repo in the config file, e.g. "signingKeys": { "project-chip/zap": [ { "type": "minisign", "key": "RWQ..." } ] }.
+// The key is either given inline, or read from a file.
+type SigningKey struct {
+	// Either 'minisign' or 'pgp'.
+	Type string `mapstructure:"type"`
+	Key  string `mapstructure:"key"`
+	File string `mapstructure:"file"`
+}
+
+// Suffixes of detached signatures: minisign, and binary or armored OpenPGP.
+var signatureSuffixes = []string{".minisig", ".sig", ".asc"}
+
+// Returned when a signature can't be checked, because no key of its type is configured.
+var errNoTrustedKey = errors.New("no trusted key is configured for this kind of signature")
+
+// Returns the name of the asset that a detached signature belongs to, or an empty string if the asset is not a signature.
+func signedAssetName(name string) string {
+	for _, suffix := range signatureSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+	return ""
+}
+
+// Returns the signature assets of a release, keyed by the name of the asset they sign.
+func signatureAssets(assets []*github.ReleaseAsset) map[string]*github.ReleaseAsset {
+	signatures := map[string]*github.ReleaseAsset{}
+	for _, asset := range assets {
+		if name := signedAssetName(asset.GetName()); name != "" {
+			signatures[name] = asset
+		}
+	}
+	return signatures
+}
+
+type minisignKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// Checks detached signatures against the trusted keys of a repo.
+type signatureVerifier struct {
+	minisign []minisignKey
+	pgp      openpgp.EntityList
+}
+
+// Parses the configured keys.
+func newSignatureVerifier(keys []SigningKey) (*signatureVerifier, error) {
+	v := &signatureVerifier{}
+	for _, key := range keys {
+		data := []byte(key.Key)
+		if key.File != "" {
+			var err error
+			if data, err = os.ReadFile(key.File); err != nil {
+				return nil, err
+			}
+		}
+		switch strings.ToLower(key.Type) {
+		case "minisign":
+			k, err := parseMinisignKey(data)
+			if err != nil {
+				return nil, err
+			}
+			v.minisign = append(v.minisign, k)
+		case "pgp", "openpgp", "gpg":
+			entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+			if err != nil {
+				// Not armored, try a binary key.
+				if entities, err = openpgp.ReadKeyRing(bytes.NewReader(data)); err != nil {
+					return nil, fmt.Errorf("invalid OpenPGP key: %v", err)
+				}
+			}
+			v.pgp = append(v.pgp, entities...)
+		default:
+			return nil, fmt.Errorf("unknown signing key type '%v', use 'minisign' or 'pgp'", key.Type)
+		}
+	}
+	return v, nil
+}
+
+// Returns true if a key is configured that can check the given signature.
+func (v *signatureVerifier) canVerify(signatureName string) bool {
+	if strings.HasSuffix(signatureName, ".minisig") {
+		return len(v.minisign) > 0
+	}
+	return len(v.pgp) > 0
+}
+
+// Checks that signature, read from the asset signatureName, is a valid signature of content by a trusted key.
+func (v *signatureVerifier) verify(signatureName string, signature []byte, content io.Reader) error {
+	if !v.canVerify(signatureName) {
+		return errNoTrustedKey
+	}
+	if strings.HasSuffix(signatureName, ".minisig") {
+		return v.verifyMinisign(signature, content)
+	}
+	var err error
+	if bytes.Contains(signature, []byte("-----BEGIN PGP SIGNATURE-----")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(v.pgp, content, bytes.NewReader(signature), nil)
+	} else {
+		_, err = openpgp.CheckDetachedSignature(v.pgp, content, bytes.NewReader(signature), nil)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid OpenPGP signature %v: %v", signatureName, err)
+	}
+	return nil
+}
+
+// Checks the signature of a file.
+func (v *signatureVerifier) verifyFile(signatureName string, signature []byte, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return v.verify(signatureName, signature, file)
+}
+
+// Returns true if a file that is already present has a valid signature, stored next to it by an earlier download.
+func (d *downloader) verifyLocalSignature(signaturePath string, path string) bool {
+	signature, err := os.ReadFile(signaturePath)
+	return err == nil && d.verifier.verifyFile(filepath.Base(signaturePath), signature, path) == nil
+}
+
+// Parses a minisign public key, either the base64 encoded key alone or the whole key file.
+// The decoded key is the 'Ed' algorithm, an 8 byte key id, and the 32 byte ed25519 key.
+func parseMinisignKey(data []byte) (minisignKey, error) {
+	decoded, err := base64.StdEncoding.DecodeString(lastLine(data, "untrusted comment:"))
+	if err != nil || len(decoded) != 42 || string(decoded[:2]) != "Ed" {
+		return minisignKey{}, fmt.Errorf("invalid minisign public key")
+	}
+	return minisignKey{id: decoded[2:10], key: ed25519.PublicKey(decoded[10:])}, nil
+}
+
+// Checks a minisign signature file: an untrusted comment, the signature, a trusted comment, and
+// a global signature over the signature and the trusted comment. The signature is either over
+// the content itself ('Ed'), or over its BLAKE2b-512 hash ('ED', the default of current minisign).
+func (v *signatureVerifier) verifyMinisign(signature []byte, content io.Reader) error {
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	sig, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sig) != 74 {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return fmt.Errorf("invalid minisign signature")
+	}
+	var key *minisignKey
+	for i := range v.minisign {
+		if bytes.Equal(v.minisign[i].id, sig[2:10]) {
+			key = &v.minisign[i]
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("minisign signature was made with key %X, which is not trusted", sig[2:10])
+	}
+	var message []byte
+	switch string(sig[:2]) {
+	case "ED":
+		hasher, _ := blake2b.New512(nil)
+		if _, err := io.Copy(hasher, content); err != nil {
+			return err
+		}
+		message = hasher.Sum(nil)
+	case "Ed":
+		if message, err = io.ReadAll(content); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm '%v'", string(sig[:2]))
+	}
+	if !ed25519.Verify(key.key, message, sig[10:]) {
+		return fmt.Errorf("minisign signature does not match")
+	}
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	if !ed25519.Verify(key.key, append(append([]byte{}, sig[10:]...), trustedComment...), globalSig) {
+		return fmt.Errorf("minisign trusted comment signature does not match")
+	}
+	return nil
+}
+
+// Returns the last non-empty line that doesn't start with the comment prefix.
+func lastLine(data []byte, commentPrefix string) string {
+	result := ""
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, commentPrefix) {
+			result = line
+		}
+	}
+	return result
+}
+
+// Verifies the signatures of release files that were downloaded from somewhere other than Github,
+// such as Artifactory. Signature and checksum files are stored next to the assets they sign when
+// assets are downloaded from Github, so they are cached together. A file is trusted if its own
+// signature is valid, or if its checksum is listed in a checksum file with a valid signature.
+// Files with invalid signatures are removed. With RequireSignature, files that can't be verified are an error.
+func VerifySignatures(cfg *GithubConfiguration, directory string) error {
+	if len(cfg.SigningKeys) == 0 && !cfg.RequireSignature {
+		return nil
+	}
+	v, err := newSignatureVerifier(cfg.SigningKeys)
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		return err
+	}
+	present := map[string]bool{}
+	for _, entry := range entries {
+		present[entry.Name()] = true
+	}
+	signatureOf := func(name string) (string, []byte) {
+		for _, suffix := range signatureSuffixes {
+			if present[name+suffix] && v.canVerify(name+suffix) {
+				if data, err := os.ReadFile(filepath.Join(directory, name+suffix)); err == nil {
+					return name + suffix, data
+				}
+			}
+		}
+		return "", nil
+	}
+
+	// Checksums from signed checksum files.
+	signedChecksums := map[string]string{}
+	for name := range present {
+		if !isChecksumAsset(name) {
+			continue
+		}
+		signatureName, signature := signatureOf(name)
+		if signature == nil {
+			continue
+		}
+		path := filepath.Join(directory, name)
+		if err := v.verifyFile(signatureName, signature, path); err != nil {
+			return fmt.Errorf("%v: %v", path, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for file, sum := range parseChecksums(data) {
+			signedChecksums[file] = sum
+		}
+	}
+
+	for name := range present {
+		if signedAssetName(name) != "" || isChecksumAsset(name) || strings.HasPrefix(name, ".") || strings.HasSuffix(name, PartSuffix) || strings.HasSuffix(name, PartMetadataSuffix) {
+			continue
+		}
+		path := filepath.Join(directory, name)
+		if signatureName, signature := signatureOf(name); signature != nil {
+			if err := v.verifyFile(signatureName, signature, path); err != nil {
+				os.Remove(path)
+				return fmt.Errorf("%v: %v, the file was removed", path, err)
+			}
+			fmt.Printf("Verified signature of %v.\n", path)
+		} else if sum, ok := signedChecksums[name]; ok {
+			expected := expectedChecksum{size: -1, sha256: sum}
+			if !expected.matchesFile(path) {
+				os.Remove(path)
+				return fmt.Errorf("SHA-256 mismatch for %v against a signed checksum file, the file was removed", path)
+			}
+			fmt.Printf("Verified signed checksum of %v.\n", path)
+		} else if cfg.RequireSignature {
+			return fmt.Errorf("%v has no signature that can be verified with the configured keys", path)
+		}
+	}
+	return nil
+}
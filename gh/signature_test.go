@@ -0,0 +1,134 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+)
+
+// A key and signatures of the content "test" made by minisign, from the tests of github.com/jedisct1/go-minisign.
+const (
+	minisignPublicKey = "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3"
+	minisignKeyFile   = "untrusted comment: minisign public key E7620F1842B4E81F\n" + minisignPublicKey + "\n"
+	// Signature over the content itself.
+	minisignLegacySignature = "untrusted comment: signature from minisign secret key\n" +
+		"RWQf6LRCGA9i59SLOFxz6NxvASXDJeRtuZykwQepbDEGt87ig1BNpWaVWuNrm73YiIiJbq71Wi+dP9eKL8OC351vwIasSSbXxwA=\n" +
+		"trusted comment: timestamp:1635442742\tfile:test\n" +
+		"0YteLgV960ia80vnA/fHbvkyjl/IoP/HNOCaZfrF0CdhAlp7ok+Tpkya+VpWPX5C/Is3q8a/kEDSY7fBmmgJCg==\n"
+	// Signature over the BLAKE2b-512 hash of the content.
+	minisignPrehashedSignature = "untrusted comment: signature from minisign secret key\n" +
+		"RUQf6LRCGA9i559r3g7V1qNyJDApGip8MfqcadIgT9CuhV3EMhHoN1mGTkUidF/z7SrlQgXdy8ofjb7bNJJylDOocrCo8KLzZwo=\n" +
+		"trusted comment: timestamp:1635443258\tfile:test\thashed\n" +
+		"/cj37GK60vryibFn+ftOgbCvW9NKhKYgjVpFFQUcWPAnjO23wrvVDTt7cloNC06maoBli9q6qwZDXXoaxweICQ==\n"
+	// Another key, which didn't make the signatures.
+	otherMinisignPublicKey = "RWQBAgMEBQYHCGRlZmdoaWprbG1ub3BxcnN0dXZ3eHl6e3x9fn+AgYKD"
+)
+
+func TestParseMinisignKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{"key", minisignPublicKey, false},
+		{"key file", minisignKeyFile, false},
+		{"not base64", "RWQ!", true},
+		{"too short", "RWQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0Q", true},
+		{"wrong algorithm", "RUQf6LRCGA9i53mlYecO4IzT51TGPpvWucNSCh1CBM0QTaLn73Y7GFO3", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := parseMinisignKey([]byte(test.data))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("parseMinisignKey() error = %v, wantErr %v", err, test.wantErr)
+			}
+			if err == nil && len(key.key) != 32 {
+				t.Errorf("parseMinisignKey() key has %v bytes, want 32", len(key.key))
+			}
+		})
+	}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	tamperedComment := strings.Replace(minisignPrehashedSignature, "timestamp:1635443258", "timestamp:1635443259", 1)
+	tests := []struct {
+		name      string
+		key       string
+		signature string
+		content   string
+		wantErr   string
+	}{
+		{"Ed", minisignPublicKey, minisignLegacySignature, "test", ""},
+		{"ED", minisignPublicKey, minisignPrehashedSignature, "test", ""},
+		{"Ed with other content", minisignPublicKey, minisignLegacySignature, "tset", "does not match"},
+		{"ED with other content", minisignPublicKey, minisignPrehashedSignature, "tset", "does not match"},
+		{"tampered trusted comment", minisignPublicKey, tamperedComment, "test", "trusted comment"},
+		{"untrusted key", otherMinisignPublicKey, minisignPrehashedSignature, "test", "not trusted"},
+		{"truncated signature", minisignPublicKey, minisignPrehashedSignature[:60], "test", "invalid minisign signature"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			v, err := newSignatureVerifier([]SigningKey{{Type: "minisign", Key: test.key}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = v.verify("test.minisig", []byte(test.signature), strings.NewReader(test.content))
+			if test.wantErr == "" && err != nil {
+				t.Fatalf("verify() error = %v", err)
+			}
+			if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+				t.Fatalf("verify() error = %v, want an error containing '%v'", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyPgp(t *testing.T) {
+	entity, err := openpgp.NewEntity("get-zap test", "", "test@example.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var publicKey bytes.Buffer
+	w, err := armor.Encode(&publicKey, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	var binary, armored bytes.Buffer
+	if err := openpgp.DetachSign(&binary, entity, strings.NewReader("test"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := openpgp.ArmoredDetachSign(&armored, entity, strings.NewReader("test"), nil); err != nil {
+		t.Fatal(err)
+	}
+	v, err := newSignatureVerifier([]SigningKey{{Type: "pgp", Key: publicKey.String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		signature []byte
+		content   string
+		wantErr   bool
+	}{
+		{"test.sig", binary.Bytes(), "test", false},
+		{"test.asc", armored.Bytes(), "test", false},
+		{"test.sig", binary.Bytes(), "tset", true},
+		{"test.asc", armored.Bytes(), "tset", true},
+	}
+	for _, test := range tests {
+		err := v.verify(test.name, test.signature, strings.NewReader(test.content))
+		if (err != nil) != test.wantErr {
+			t.Errorf("verify(%v, %v) error = %v, wantErr %v", test.name, test.content, err, test.wantErr)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Default maximum size of a downloaded asset.
+const DefaultMaxSize = "4GiB"
+
+var sizeUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"kib", 1 << 10}, {"mib", 1 << 20}, {"gib", 1 << 30},
+	{"kb", 1000}, {"mb", 1000 * 1000}, {"gb", 1000 * 1000 * 1000},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30},
+	{"b", 1},
+}
+
+// Parses a size in bytes, optionally with a unit such as '500MB' or '2GiB'. Single letter units are binary.
+func ParseSize(value string) (int64, error) {
+	number := strings.ToLower(strings.TrimSpace(value))
+	factor := int64(1)
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			factor = unit.factor
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	bytes := size * float64(factor)
+	// Values such as 'inf', 'nan' or '1e30' would wrap around and silently disable a limit.
+	if err != nil || size < 0 || math.IsNaN(bytes) || math.IsInf(bytes, 0) || bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid size '%v', expected e.g. '500MB' or '2GiB'", value)
+	}
+	return int64(bytes), nil
+}
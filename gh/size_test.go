@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"silabs/get-zap/progress"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{"0", 0, false},
+		{"1024", 1024, false},
+		{"100b", 100, false},
+		{"1k", 1 << 10, false},
+		{"1K", 1 << 10, false},
+		{"1KiB", 1 << 10, false},
+		{"1kb", 1000, false},
+		{"500MB", 500 * 1000 * 1000, false},
+		{"5M", 5 << 20, false},
+		{"2GiB", 2 << 30, false},
+		{"4GiB", 4 << 30, false},
+		{"1.5 GiB", 3 << 29, false},
+		{" 2g ", 2 << 30, false},
+		{"1e3", 1000, false},
+		{"", 0, true},
+		{"MB", 0, true},
+		{"-1", 0, true},
+		{"-1GiB", 0, true},
+		{"5 TB", 0, true},
+		{"five", 0, true},
+		// Would wrap around, or not be a number of bytes at all.
+		{"nan", 0, true},
+		{"NaN MB", 0, true},
+		{"inf", 0, true},
+		{"+Inf", 0, true},
+		{"1e30", 0, true},
+		{"9223372036854775807", 0, true},
+		{"8589934592g", 0, true},
+		{"8589934591g", 8589934591 << 30, false},
+	}
+	for _, test := range tests {
+		got, err := ParseSize(test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ParseSize(%v) = %v, %v, want %v, error %v", test.value, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestCopyDownload(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     int
+		offset   int64
+		maxSize  int64
+		want     int64
+		tooLarge bool
+	}{
+		{"no limit", 100000, 0, 0, 100000, false},
+		{"below the limit", 1000, 0, 1001, 1000, false},
+		{"at the limit", 1000, 0, 1000, 1000, false},
+		{"above the limit", 1001, 0, 1000, 1001, true},
+		{"well above the limit", 100000, 0, 1000, 32 * 1024, true},
+		{"resumed below the limit", 400, 600, 1000, 1000, false},
+		{"resumed above the limit", 401, 600, 1000, 1001, true},
+		{"empty", 0, 0, 1000, 0, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var written bytes.Buffer
+			body := bytes.NewReader(testContent(test.body, 0))
+			transfer := (*progress.Reporter)(nil).Start(test.name, -1, test.offset)
+			total, err := copyDownload(&written, body, test.offset, test.maxSize, transfer)
+			if errors.Is(err, errTooLarge) != test.tooLarge || (err != nil && !test.tooLarge) {
+				t.Fatalf("copyDownload() error = %v, want too large %v", err, test.tooLarge)
+			}
+			if total != test.want {
+				t.Errorf("copyDownload() = %v, want %v", total, test.want)
+			}
+			if int64(written.Len()) != total-test.offset {
+				t.Errorf("copyDownload() wrote %v bytes, want %v", written.Len(), total-test.offset)
+			}
+		})
+	}
+}
+
+// Streams content without a Content-Length, in chunks.
+func serveChunked(content []byte) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for start := 0; start < len(content); start += 10000 {
+			end := start + 10000
+			if end > len(content) {
+				end = len(content)
+			}
+			w.Write(content[start:end])
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func TestDownloadWithoutLength(t *testing.T) {
+	content := testContent(100000, 0)
+	tests := []struct {
+		name    string
+		maxSize int64
+		wantErr string
+	}{
+		{"no limit", 0, ""},
+		{"below the limit", 100000, ""},
+		{"above the limit", 50000, "exceeds the maximum size of 50000 bytes"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			path := filepath.Join(directory, "asset.zip")
+			server := newAssetServer(t, serveChunked(content))
+			sec := DefaultSecurityOptions()
+			sec.SetAllowHttp(true)
+			sec.SetMaxSize(test.maxSize)
+			// A mirror doesn't tell the size of the asset either.
+			expected := &expectedChecksum{size: -1}
+			err := downloadFileFromUrl(context.Background(), server.Client(), server.URL+"/asset.zip", directory, "asset.zip", expected, sec, nil)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("download error = %v, want one containing '%v'", err, test.wantErr)
+				}
+				for _, suffix := range []string{"", PartSuffix, PartMetadataSuffix} {
+					if _, err := os.Stat(path + suffix); err == nil {
+						t.Errorf("asset.zip%v was kept", suffix)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("download error = %v", err)
+			}
+			if data, _ := os.ReadFile(path); !bytes.Equal(data, content) {
+				t.Errorf("downloaded %v bytes that differ from the asset", len(data))
+			}
+		})
+	}
+}
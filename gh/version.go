@@ -0,0 +1,246 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a parsed release tag. Tags such as 'v1.2.3', '1.2' or zap's date-style
+// 'v2024.01.05-nightly' are all accepted: the numeric components are compared in order,
+// and anything after the first '-' is treated as a pre-release label.
+type Version struct {
+	Numbers    []int
+	Prerelease string
+}
+
+// Parses a release tag into a comparable version.
+func ParseVersion(tag string) (*Version, error) {
+	s := strings.TrimPrefix(strings.TrimPrefix(tag, "v"), "V")
+	if i := strings.Index(s, "+"); i >= 0 {
+		// Build metadata does not participate in comparisons.
+		s = s[:i]
+	}
+	v := &Version{}
+	if i := strings.Index(s, "-"); i >= 0 {
+		v.Prerelease = s[i+1:]
+		s = s[:i]
+	}
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("'%v' is not a valid version", tag)
+		}
+		v.Numbers = append(v.Numbers, n)
+	}
+	return v, nil
+}
+
+func (v *Version) String() string {
+	parts := make([]string, len(v.Numbers))
+	for i, n := range v.Numbers {
+		parts[i] = strconv.Itoa(n)
+	}
+	s := strings.Join(parts, ".")
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Returns -1, 0 or 1 if v is lower than, equal to, or greater than other.
+// Missing numeric components count as 0, and a version with a pre-release label
+// is lower than the same version without one.
+func (v *Version) Compare(other *Version) int {
+	for i := 0; i < len(v.Numbers) || i < len(other.Numbers); i++ {
+		a, b := 0, 0
+		if i < len(v.Numbers) {
+			a = v.Numbers[i]
+		}
+		if i < len(other.Numbers) {
+			b = other.Numbers[i]
+		}
+		if a != b {
+			return compareInts(a, b)
+		}
+	}
+	if v.Prerelease == other.Prerelease {
+		return 0
+	}
+	if v.Prerelease == "" {
+		return 1
+	}
+	if other.Prerelease == "" {
+		return -1
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+func compareInts(a int, b int) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Compares pre-release labels the semver way: dot separated identifiers, numeric ones
+// compared as numbers and lower than alphanumeric ones.
+func comparePrerelease(a string, b string) int {
+	aIds := strings.Split(a, ".")
+	bIds := strings.Split(b, ".")
+	for i := 0; i < len(aIds) && i < len(bIds); i++ {
+		aNum, aErr := strconv.Atoi(aIds[i])
+		bNum, bErr := strconv.Atoi(bIds[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				return compareInts(aNum, bNum)
+			}
+		case aErr == nil:
+			return -1
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(aIds[i], bIds[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(len(aIds), len(bIds))
+}
+
+type versionComparison struct {
+	op      string
+	version *Version
+}
+
+func (c *versionComparison) matches(v *Version) bool {
+	r := v.Compare(c.version)
+	switch c.op {
+	case "<":
+		return r < 0
+	case "<=":
+		return r <= 0
+	case ">":
+		return r > 0
+	case ">=":
+		return r >= 0
+	case "!=":
+		return r != 0
+	default:
+		return r == 0
+	}
+}
+
+// VersionConstraint is a parsed version range expression, such as '>=v2024.03.14',
+// '~v2024.04', '^1.2' or '>=1.2, <2'. Comparisons separated by commas or spaces must all
+// match, and groups of comparisons can be combined with '||'.
+type VersionConstraint struct {
+	groups [][]versionComparison
+}
+
+// Returns true if the release selector is a version constraint rather than a tag name.
+func IsVersionConstraint(s string) bool {
+	return s != "" && strings.ContainsAny(s[:1], "<>=!~^")
+}
+
+// Parses a version range expression.
+func ParseVersionConstraint(s string) (*VersionConstraint, error) {
+	constraint := &VersionConstraint{}
+	for _, group := range strings.Split(s, "||") {
+		var comparisons []versionComparison
+		tokens := strings.Fields(strings.ReplaceAll(group, ",", " "))
+		for i := 0; i < len(tokens); i++ {
+			token := tokens[i]
+			// Allow a space between the operator and the version, as in '>= v1.2'.
+			if strings.Trim(token, "<>=!~^") == "" && i+1 < len(tokens) {
+				i++
+				token += tokens[i]
+			}
+			cs, err := parseVersionComparison(token)
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint '%v': %v", s, err)
+			}
+			comparisons = append(comparisons, cs...)
+		}
+		if len(comparisons) == 0 {
+			return nil, fmt.Errorf("invalid version constraint '%v'", s)
+		}
+		constraint.groups = append(constraint.groups, comparisons)
+	}
+	return constraint, nil
+}
+
+func parseVersionComparison(token string) ([]versionComparison, error) {
+	op := token[:len(token)-len(strings.TrimLeft(token, "<>=!~^"))]
+	v, err := ParseVersion(token[len(op):])
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "", "=", "==":
+		return []versionComparison{{"=", v}}, nil
+	case "<", ">=":
+		// Pre-releases belong to the range of their version: '>=v2024.03.14' includes
+		// 'v2024.03.14-nightly', and '<v2024.04' does not include 'v2024.04-nightly'.
+		return []versionComparison{{op, lowerBound(v)}}, nil
+	case "<=", ">", "!=":
+		return []versionComparison{{op, v}}, nil
+	case "~":
+		// Allows changes after the second component: ~1.2.3 is >=1.2.3 <1.3, ~1 is >=1 <2.
+		bump := 0
+		if len(v.Numbers) > 1 {
+			bump = 1
+		}
+		return []versionComparison{{">=", lowerBound(v)}, {"<", upperBound(v, bump)}}, nil
+	case "^":
+		// Allows changes that do not modify the first non-zero component: ^1.2 is >=1.2 <2.
+		bump := len(v.Numbers) - 1
+		for i, n := range v.Numbers {
+			if n != 0 {
+				bump = i
+				break
+			}
+		}
+		return []versionComparison{{">=", lowerBound(v)}, {"<", upperBound(v, bump)}}, nil
+	}
+	return nil, fmt.Errorf("unknown operator '%v'", op)
+}
+
+// Returns the version with the lowest possible pre-release label, which sorts before
+// all pre-releases of that version. Versions that have a label are returned unchanged.
+func lowerBound(v *Version) *Version {
+	if v.Prerelease != "" {
+		return v
+	}
+	return &Version{Numbers: v.Numbers, Prerelease: "0"}
+}
+
+// Returns the exclusive upper bound of a range, with the component at index bump incremented.
+func upperBound(v *Version, bump int) *Version {
+	numbers := append([]int{}, v.Numbers[:bump+1]...)
+	numbers[bump]++
+	return lowerBound(&Version{Numbers: numbers})
+}
+
+// Returns true if the version satisfies the constraint.
+func (c *VersionConstraint) Matches(v *Version) bool {
+	for _, group := range c.groups {
+		matched := true
+		for i := range group {
+			if !group[i].matches(v) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,227 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package gh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/github"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		tag     string
+		want    string
+		wantErr bool
+	}{
+		{"v1.2.3", "1.2.3", false},
+		{"V1.2", "1.2", false},
+		{"1", "1", false},
+		{"v2024.01.05-nightly", "2024.1.5-nightly", false},
+		{"v1.2.3-rc.1+build.5", "1.2.3-rc.1", false},
+		{"latest", "", true},
+		{"v1.x", "", true},
+		{"v1..2", "", true},
+	}
+	for _, test := range tests {
+		v, err := ParseVersion(test.tag)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseVersion(%v) error = %v, wantErr %v", test.tag, err, test.wantErr)
+			continue
+		}
+		if err == nil && v.String() != test.want {
+			t.Errorf("ParseVersion(%v) = %v, want %v", test.tag, v, test.want)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2", "v1.2.0", 0},
+		{"v1.10", "v1.9", 1},
+		{"v2024.04.01", "v2024.03.14", 1},
+		{"v2024.04.01-nightly", "v2024.04.01", -1},
+		{"v2024.04.01-nightly", "v2024.03.14", 1},
+		{"v1.0.0-alpha", "v1.0.0-alpha.1", -1},
+		{"v1.0.0-alpha.1", "v1.0.0-alpha.beta", -1},
+		{"v1.0.0-beta.2", "v1.0.0-beta.11", -1},
+		{"v1.0.0-rc.1", "v1.0.0-beta.11", 1},
+	}
+	for _, test := range tests {
+		a, _ := ParseVersion(test.a)
+		b, _ := ParseVersion(test.b)
+		if got := a.Compare(b); got != test.want {
+			t.Errorf("%v.Compare(%v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+		if got := b.Compare(a); got != -test.want {
+			t.Errorf("%v.Compare(%v) = %v, want %v", test.b, test.a, got, -test.want)
+		}
+	}
+}
+
+func TestVersionConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matching   []string
+		others     []string
+	}{
+		// Pre-releases of the lower bound are in the range, the ones of the upper bound are not.
+		{">=v2024.03.14", []string{"v2024.03.14", "v2024.03.14-nightly", "v2024.04.01", "v2025.01.01"}, []string{"v2024.03.13", "v2024.03.13-nightly"}},
+		{"<v2024.04", []string{"v2024.03.31", "v2024.03.31-nightly"}, []string{"v2024.04", "v2024.04.00-nightly", "v2024.04.01-nightly"}},
+		{">v2024.03.14", []string{"v2024.03.15"}, []string{"v2024.03.14", "v2024.03.14-nightly"}},
+		{"<=v2024.03.14", []string{"v2024.03.14", "v2024.03.14-nightly"}, []string{"v2024.03.15-nightly"}},
+		{"=v2024.03.14", []string{"v2024.03.14", "2024.3.14"}, []string{"v2024.03.14-nightly"}},
+		{"v2024.03.14", []string{"v2024.03.14"}, []string{"v2024.03.15"}},
+		{"!=v2024.03.14", []string{"v2024.03.15"}, []string{"v2024.03.14"}},
+		// ~ allows changes after the second component, including nightly and patch tags.
+		{"~v2024.04", []string{"v2024.04.01", "v2024.04.01-nightly", "v2024.04.30", "v2024.04.00-nightly", "v2024.04.30.1"}, []string{"v2024.03.31", "v2024.05.01-nightly", "v2024.05.01"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.2.2", "1.3.0", "1.3.0-rc.1"}},
+		{"~1", []string{"1.0", "1.9.9"}, []string{"0.9", "2.0", "2.0.0-rc.1"}},
+		// ^ allows changes that keep the first non-zero component.
+		{"^1.2", []string{"1.2", "1.9.0", "1.2.0-rc.1"}, []string{"1.1.9", "2.0.0", "2.0.0-rc.1"}},
+		{"^0.2.3", []string{"0.2.3", "0.2.9"}, []string{"0.3.0", "0.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"^v2024", []string{"v2024.12.31", "v2024.01.01-nightly"}, []string{"v2025.01.01", "v2023.12.31"}},
+		// Comparisons separated by commas or spaces must all match.
+		{">=v2024.03.14, <v2024.04", []string{"v2024.03.14", "v2024.03.20-nightly"}, []string{"v2024.04.01", "v2024.03.13"}},
+		{">= v2024.03.14 < v2024.04", []string{"v2024.03.14"}, []string{"v2024.04.01"}},
+		// Groups separated by || match if any of them does.
+		{"~v2024.03 || ~v2024.05", []string{"v2024.03.14", "v2024.05.01-nightly"}, []string{"v2024.04.01"}},
+		{"<1 || >=2, <3", []string{"0.9", "2.5"}, []string{"1.0", "3.0"}},
+		// A constraint with a pre-release only matches pre-releases from that one on.
+		{">=v2024.04.01-nightly", []string{"v2024.04.01-nightly", "v2024.04.01"}, []string{"v2024.03.31"}},
+	}
+	for _, test := range tests {
+		c, err := ParseVersionConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("ParseVersionConstraint(%v) error = %v", test.constraint, err)
+			continue
+		}
+		for _, tag := range test.matching {
+			if v, _ := ParseVersion(tag); !c.Matches(v) {
+				t.Errorf("'%v' doesn't match %v", test.constraint, tag)
+			}
+		}
+		for _, tag := range test.others {
+			if v, _ := ParseVersion(tag); c.Matches(v) {
+				t.Errorf("'%v' matches %v", test.constraint, tag)
+			}
+		}
+	}
+}
+
+func TestParseVersionConstraintErrors(t *testing.T) {
+	for _, constraint := range []string{"", ">=", ">=latest", "~v2024.04 ||", "=>1.2", "<>1"} {
+		if _, err := ParseVersionConstraint(constraint); err == nil {
+			t.Errorf("ParseVersionConstraint(%v) succeeded, want an error", constraint)
+		}
+	}
+}
+
+func TestIsVersionConstraint(t *testing.T) {
+	tests := map[string]bool{
+		"~v2024.04":     true,
+		">=v2024.03.14": true,
+		"^1.2":          true,
+		"v2024.03.14":   false,
+		"latest":        false,
+		"all":           false,
+		"":              false,
+	}
+	for s, want := range tests {
+		if got := IsVersionConstraint(s); got != want {
+			t.Errorf("IsVersionConstraint(%v) = %v, want %v", s, got, want)
+		}
+	}
+}
+
+// Serves the releases of project-chip/zap like the Github API, and returns a client for it.
+func newTestReleaseClient(t *testing.T, releases []*github.RepositoryRelease, latest string) *GithubClient {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/repos/project-chip/zap/releases", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+	mux.HandleFunc("/repos/project-chip/zap/releases/latest", func(w http.ResponseWriter, r *http.Request) {
+		for _, release := range releases {
+			if release.GetTagName() == latest {
+				json.NewEncoder(w).Encode(release)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/repos/project-chip/zap/releases/tags/", func(w http.ResponseWriter, r *http.Request) {
+		tag := strings.TrimPrefix(r.URL.Path, "/repos/project-chip/zap/releases/tags/")
+		for _, release := range releases {
+			if release.GetTagName() == tag {
+				json.NewEncoder(w).Encode(release)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := github.NewClient(server.Client())
+	client.BaseURL, _ = url.Parse(server.URL + "/")
+	return &GithubClient{Client: client}
+}
+
+func TestResolveRelease(t *testing.T) {
+	release := func(tag string, published string, prerelease bool, draft bool) *github.RepositoryRelease {
+		date, _ := time.Parse("2006-01-02", published)
+		return &github.RepositoryRelease{TagName: github.String(tag), PublishedAt: &github.Timestamp{Time: date}, Prerelease: github.Bool(prerelease), Draft: github.Bool(draft)}
+	}
+	releases := []*github.RepositoryRelease{
+		release("v2024.05.01-nightly", "2024-05-01", false, false),
+		release("v2024.04.30-nightly", "2024-04-30", false, false),
+		release("v2024.04.15", "2024-04-15", false, false),
+		release("v2024.04.15.1", "2024-04-18", false, false),
+		release("v2024.04.02-rc", "2024-04-02", true, false),
+		release("v2024.03.14", "2024-03-14", false, false),
+		release("v2024.06.01", "2024-04-20", false, true),
+	}
+	client := newTestReleaseClient(t, releases, "v2024.04.15.1")
+	tests := []struct {
+		name    string
+		release string
+		channel string
+		before  string
+		want    string
+	}{
+		{"Github's latest", "latest", "", "", "v2024.04.15.1"},
+		{"latest nightly", "latest", "nightly", "", "v2024.05.01-nightly"},
+		{"latest stable before a date", "latest", "stable", "2024-04-16", "v2024.04.15"},
+		{"latest any", "latest", "any", "", "v2024.05.01-nightly"},
+		{"exact tag", "v2024.03.14", "", "", "v2024.03.14"},
+		{"missing tag", "v2023.01.01", "", "", ""},
+		{"highest in range", "~v2024.04", "", "", "v2024.04.30-nightly"},
+		{"highest stable in range", "~v2024.04", "stable", "", "v2024.04.15.1"},
+		{"highest nightly in range", "~v2024.04", "nightly", "", "v2024.04.30-nightly"},
+		{"highest prerelease in range", "~v2024.04", "prerelease", "", "v2024.04.02-rc"},
+		{"drafts are skipped", ">=v2024.06", "", "", ""},
+		{"range and date", ">=v2024.03.14", "", "2024-04-01", "v2024.03.14"},
+		{"no match", "^v2025", "", "", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			before, _ := ParseReleaseDate(test.before)
+			cfg := &GithubConfiguration{Owner: "project-chip", Repo: "zap", Release: test.release, Channel: test.channel, ReleasedBefore: before}
+			if got := ResolveRelease(context.Background(), client, cfg).GetTagName(); got != test.want {
+				t.Errorf("ResolveRelease() = '%v', want '%v'", got, test.want)
+			}
+		})
+	}
+}
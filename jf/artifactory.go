@@ -5,12 +5,19 @@ package jf
 
 import (
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"silabs/get-zap/progress"
+	"silabs/get-zap/throttle"
 
 	"github.com/jfrog/jfrog-client-go/artifactory"
 	rtAuth "github.com/jfrog/jfrog-client-go/artifactory/auth"
 	"github.com/jfrog/jfrog-client-go/artifactory/services"
 	"github.com/jfrog/jfrog-client-go/auth"
 	"github.com/jfrog/jfrog-client-go/config"
+	"github.com/jfrog/jfrog-client-go/utils/log"
 	"github.com/spf13/cobra"
 )
 
@@ -20,6 +27,23 @@ type ArtifactoryConfiguration struct {
 	User   string
 	Repo   string
 	Path   string
+	// Returns the proxy of each request to Artifactory, or nil for a direct connection, like the Proxy of
+	// an http.Transport. If nil, the HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables are used.
+	Proxy func(*http.Request) (*url.URL, error)
+	// PEM files with additional CA certificates that are trusted besides the system ones.
+	CaBundles []string
+	// PEM files of the client certificate and its key, for an Artifactory that requires mutual TLS.
+	// The key may be in the certificate file, if ClientKey is empty.
+	ClientCert string
+	ClientKey  string
+	// If true, the certificate of the server is not verified.
+	InsecureSkipVerify bool
+	// If true, the proxy and the requests of the JFrog client are logged.
+	Debug bool
+	// Reports the progress of uploads and downloads, if not nil.
+	Progress *progress.Reporter
+	// Limits the rate of downloads, if not nil.
+	Limiter *throttle.Limiter
 }
 
 func (cfg *ArtifactoryConfiguration) IsValid() bool {
@@ -34,17 +58,58 @@ func (cfg *ArtifactoryConfiguration) CreateDetails() *auth.ServiceDetails {
 	rtDetails.SetUrl(cfg.Url)
 	rtDetails.SetApiKey(cfg.ApiKey)
 	rtDetails.SetUser(cfg.User)
+	if cfg.ClientCert != "" {
+		rtDetails.SetClientCertPath(cfg.ClientCert)
+		if cfg.ClientKey != "" {
+			rtDetails.SetClientCertKeyPath(cfg.ClientKey)
+		} else {
+			rtDetails.SetClientCertKeyPath(cfg.ClientCert)
+		}
+	}
 	return &rtDetails
 }
 
-func ArtifactoryDelete(cfg *ArtifactoryConfiguration, pattern string) {
+func createServicesManager(cfg *ArtifactoryConfiguration) artifactory.ArtifactoryServicesManager {
 	rtDetails := cfg.CreateDetails()
 
-	s, err := config.NewConfigBuilder().SetServiceDetails(*rtDetails).Build()
+	builder := config.NewConfigBuilder().SetServiceDetails(*rtDetails).SetInsecureTls(cfg.InsecureSkipVerify)
+	if len(cfg.CaBundles) > 0 {
+		// The JFrog client loads every file of a certificates directory, and only reads them while the manager is created.
+		certificates, err := os.MkdirTemp("", "get-zap-certs")
+		cobra.CheckErr(err)
+		defer os.RemoveAll(certificates)
+		for i, caBundle := range cfg.CaBundles {
+			pem, err := os.ReadFile(caBundle)
+			cobra.CheckErr(err)
+			cobra.CheckErr(os.WriteFile(filepath.Join(certificates, fmt.Sprintf("ca%v.pem", i)), pem, 0600))
+		}
+		builder.SetCertificatesPath(certificates)
+	}
+	// The JFrog client panics on its first log line without a logger.
+	if cfg.Debug {
+		log.SetLogger(log.NewLogger(log.DEBUG, nil))
+	} else {
+		log.SetLogger(log.NewLogger(log.WARN, nil))
+	}
+	s, err := builder.Build()
 	cobra.CheckErr(err)
 
-	m, err := artifactory.New(s)
+	var m artifactory.ArtifactoryServicesManager
+	if cfg.Progress != nil || cfg.Limiter != nil {
+		// The progress manager gets to wrap the body of each transfer, which is also where downloads are limited.
+		m, err = artifactory.NewWithProgress(s, newProgressManager(cfg.Progress, cfg.Limiter))
+	} else {
+		m, err = artifactory.New(s)
+	}
 	cobra.CheckErr(err)
+	if cfg.Proxy != nil {
+		cobra.CheckErr(setProxy(m, cfg.Proxy))
+	}
+	return m
+}
+
+func ArtifactoryDelete(cfg *ArtifactoryConfiguration, pattern string) {
+	m := createServicesManager(cfg)
 
 	params := services.NewDeleteParams()
 	params.Pattern = cfg.Repo + "/" + pattern
@@ -58,19 +123,50 @@ func ArtifactoryDelete(cfg *ArtifactoryConfiguration, pattern string) {
 	fmt.Printf("Deleted files: %v\n", cnt)
 }
 
-func ArtifactoryPattern(release string, isLocal bool) string {
-	return release + "/**"
+// Returns the path within the repo under which the assets of a release for a given platform are cached.
+func ArtifactoryCachePath(release string, platform string) string {
+	return release + "/" + platform + "/"
 }
 
-func ArtifactoryDownload(cfg *ArtifactoryConfiguration, pattern string) int {
-
-	rtDetails := cfg.CreateDetails()
+// Downloads the files cached under cachePath into localDirectory. Returns the number of downloaded files.
+func ArtifactoryDownloadCached(cfg *ArtifactoryConfiguration, cachePath string, localDirectory string) int {
+	m := createServicesManager(cfg)
 
-	s, err := config.NewConfigBuilder().SetServiceDetails(*rtDetails).Build()
+	params := services.NewDownloadParams()
+	params.Pattern = cfg.Repo + "/" + cachePath + "*"
+	params.Target = localDirectory + "/"
+	params.Flat = true
+	fmt.Printf("Downloading files from %v/%v: %v\n", cfg.Url, cfg.Repo, params.Pattern)
+	success, failures, err := m.DownloadFiles(params)
 	cobra.CheckErr(err)
 
-	m, err := artifactory.New(s)
+	fmt.Printf("Downloaded files: success %v, failure %v\n", success, failures)
+	return success
+}
+
+// Uploads the given files into cachePath, where ArtifactoryDownloadCached will find them.
+func ArtifactoryUploadCached(cfg *ArtifactoryConfiguration, files []string, cachePath string) {
+	if len(files) == 0 {
+		return
+	}
+	m := createServicesManager(cfg)
+
+	var allParams []services.UploadParams
+	for _, file := range files {
+		params := services.NewUploadParams()
+		params.Pattern = file
+		params.Target = cfg.Repo + "/" + cachePath
+		params.Flat = true
+		allParams = append(allParams, params)
+	}
+	fmt.Printf("Uploading files to %v/%v: %v\n", cfg.Url, cfg.Repo, cachePath)
+	success, failures, err := m.UploadFiles(allParams...)
 	cobra.CheckErr(err)
+	fmt.Printf("Uploaded files: success %v, failure %v\n", success, failures)
+}
+
+func ArtifactoryDownload(cfg *ArtifactoryConfiguration, pattern string) int {
+	m := createServicesManager(cfg)
 
 	params := services.NewDownloadParams()
 	params.Pattern = cfg.Repo + "/" + pattern
@@ -83,16 +179,12 @@ func ArtifactoryDownload(cfg *ArtifactoryConfiguration, pattern string) int {
 }
 
 func ArtifactoryUpload(cfg *ArtifactoryConfiguration, pattern string) {
-	rtDetails := cfg.CreateDetails()
-
-	s, err := config.NewConfigBuilder().SetServiceDetails(*rtDetails).Build()
-	cobra.CheckErr(err)
-
-	m, err := artifactory.New(s)
-	cobra.CheckErr(err)
+	m := createServicesManager(cfg)
 
 	params := services.NewUploadParams()
 	params.Pattern = pattern
+	// Never upload downloads that are still in progress.
+	params.Exclusions = []string{"*.part", "*.part.json", "*.tmp"}
 	fmt.Printf("Uploading files to %v/%v: %v\n", cfg.Url, cfg.Repo, params.Pattern)
 	params.Target = cfg.Repo + "/"
 
@@ -0,0 +1,125 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package jf
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"silabs/get-zap/progress"
+	"silabs/get-zap/throttle"
+	"strings"
+	"sync"
+
+	ioutils "github.com/jfrog/jfrog-client-go/utils/io"
+)
+
+// Reports the transfers of the JFrog client through a progress.Reporter, and limits the rate of downloads.
+type progressManager struct {
+	reporter *progress.Reporter
+	limiter  *throttle.Limiter
+	mu       sync.Mutex
+	nextId   int
+	active   map[int]*transferProgress
+}
+
+func newProgressManager(reporter *progress.Reporter, limiter *throttle.Limiter) *progressManager {
+	return &progressManager{reporter: reporter, limiter: limiter, active: map[int]*transferProgress{}}
+}
+
+// A transfer of the JFrog client. Concurrent downloads of a large file read it in several chunks.
+type transferProgress struct {
+	id       int
+	total    int64
+	download bool
+	transfer *progress.Transfer
+	limiter  *throttle.Limiter
+	mu       sync.Mutex
+	bytes    int64
+	eof      bool
+}
+
+func (m *progressManager) NewProgressReader(total int64, label string, target string) ioutils.Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextId++
+	p := &transferProgress{id: m.nextId, total: total, download: strings.HasPrefix(label, "Download"), limiter: m.limiter}
+	if p.download {
+		p.transfer = m.reporter.Start(target, total, 0)
+	} else {
+		// Uploads are labeled with the target URL, followed by the properties.
+		target, _, _ = strings.Cut(target, ";")
+		p.transfer = m.reporter.StartUpload(path.Base(target), total)
+	}
+	m.active[p.id] = p
+	return p
+}
+
+func (m *progressManager) SetProgressState(id int, state string) {}
+
+func (m *progressManager) GetProgress(id int) ioutils.Progress {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active[id]
+}
+
+// Called when a transfer ends, whether it succeeded or not.
+func (m *progressManager) RemoveProgress(id int) {
+	m.mu.Lock()
+	p := m.active[id]
+	delete(m.active, id)
+	m.mu.Unlock()
+	if p != nil {
+		p.finish()
+	}
+}
+
+func (m *progressManager) Quit() {}
+
+func (m *progressManager) IncGeneralProgressTotalBy(n int64) {}
+
+func (p *transferProgress) ActionWithProgress(reader io.Reader) io.Reader {
+	if p.download {
+		reader = p.limiter.Reader(context.Background(), reader)
+	}
+	return &progressReader{reader: reader, p: p}
+}
+
+func (p *transferProgress) Abort() {}
+
+func (p *transferProgress) GetId() int {
+	return p.id
+}
+
+// The JFrog client doesn't tell whether a transfer succeeded, so it is complete once all of it was read.
+func (p *transferProgress) finish() {
+	p.mu.Lock()
+	complete := p.bytes == p.total || p.total < 0 && p.eof
+	p.mu.Unlock()
+	if complete {
+		p.transfer.Done()
+	} else {
+		p.transfer.Fail(errors.New("transfer aborted"))
+	}
+}
+
+type progressReader struct {
+	reader io.Reader
+	p      *transferProgress
+}
+
+func (r *progressReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.p.mu.Lock()
+	r.p.bytes += int64(n)
+	if err == io.EOF {
+		r.p.eof = true
+	}
+	r.p.mu.Unlock()
+	if n > 0 {
+		r.p.transfer.Add(int64(n))
+	}
+	return n, err
+}
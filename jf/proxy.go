@@ -0,0 +1,32 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package jf
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"reflect"
+	"unsafe"
+
+	"github.com/jfrog/jfrog-client-go/artifactory"
+	"github.com/jfrog/jfrog-client-go/http/httpclient"
+)
+
+// Sets the proxy of the transport of the JFrog client. The client has no option for it, and its
+// transport only takes the proxy from the environment, which net/http reads once per process.
+// So the transport is reached through the unexported HTTP client of the JFrog client.
+func setProxy(m artifactory.ArtifactoryServicesManager, proxy func(*http.Request) (*url.URL, error)) error {
+	field := reflect.ValueOf(m.Client()).Elem().FieldByName("httpClient")
+	if !field.IsValid() || field.Type() != reflect.TypeOf(&httpclient.HttpClient{}) {
+		return errors.New("the proxy of this version of the JFrog client can't be configured")
+	}
+	client := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Interface().(*httpclient.HttpClient)
+	transport, ok := client.Client.Transport.(*http.Transport)
+	if !ok {
+		return errors.New("the proxy of this version of the JFrog client can't be configured")
+	}
+	transport.Proxy = proxy
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package jf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+)
+
+// Fails when the JFrog client no longer has the HTTP client that setProxy reaches into,
+// e.g. after an upgrade of jfrog-client-go.
+func TestSetProxy(t *testing.T) {
+	var direct, proxied atomic.Int32
+	artifactory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		direct.Add(1)
+		w.Write([]byte("OK"))
+	}))
+	defer artifactory.Close()
+	// A plain HTTP proxy gets the absolute URL of the request, and answers for Artifactory.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != artifactory.Listener.Addr().String() {
+			t.Errorf("proxy got a request for %v", r.URL)
+		}
+		proxied.Add(1)
+		w.Write([]byte("OK"))
+	}))
+	defer proxy.Close()
+	proxyUrl, _ := url.Parse(proxy.URL)
+
+	var requests []string
+	cfg := &ArtifactoryConfiguration{
+		Url:    artifactory.URL + "/",
+		ApiKey: "key",
+		User:   "user",
+		Proxy: func(r *http.Request) (*url.URL, error) {
+			requests = append(requests, r.URL.Path)
+			return proxyUrl, nil
+		},
+	}
+	if _, err := createServicesManager(cfg).Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if proxied.Load() != 1 || direct.Load() != 0 || len(requests) != 1 {
+		t.Errorf("got %v requests through the proxy, %v direct ones, and %v calls of Proxy", proxied.Load(), direct.Load(), len(requests))
+	}
+
+	// Without a Proxy, the JFrog client is left as is.
+	cfg.Proxy = nil
+	if _, err := createServicesManager(cfg).Ping(); err != nil {
+		t.Fatalf("Ping() error = %v", err)
+	}
+	if proxied.Load() != 1 || direct.Load() != 1 {
+		t.Errorf("got %v requests through the proxy and %v direct ones", proxied.Load(), direct.Load())
+	}
+}
@@ -0,0 +1,361 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Progress modes.
+const (
+	// Tty on a terminal, Lines otherwise.
+	Auto = "auto"
+	// Bars with throughput and ETA, redrawn in place.
+	Tty = "tty"
+	// A summary line per transfer every few seconds, for CI logs.
+	Lines = "lines"
+	// Start, progress, done and error events as JSON lines on stderr.
+	Json = "json"
+	// Only the final line of each transfer.
+	None = "none"
+)
+
+// Modes lists the valid progress modes.
+var Modes = []string{Auto, Tty, Lines, Json, None}
+
+const (
+	download = "download"
+	upload   = "upload"
+
+	ttyInterval   = 100 * time.Millisecond
+	linesInterval = 10 * time.Second
+	jsonInterval  = time.Second
+	barWidth      = 16
+	nameWidth     = 24
+)
+
+// Reporter shows the progress of transfers that run at the same time. Other output that is printed
+// while transfers are running should go through Printf, so that it doesn't collide with the bars.
+// A nil Reporter prints messages, but no progress.
+type Reporter struct {
+	mode string
+	mu   sync.Mutex
+	// Human readable output.
+	out io.Writer
+	// JSON events.
+	events io.Writer
+	// Transfers that are shown as bars in tty mode.
+	active []*Transfer
+	// Number of bar lines on the screen.
+	drawn    int
+	lastDraw time.Time
+}
+
+// Creates a reporter for one of the Modes.
+func New(mode string) (*Reporter, error) {
+	return newReporter(mode, os.Stdout, os.Stderr, term.IsTerminal(int(os.Stdout.Fd())))
+}
+
+// Creates a reporter that writes to out, and JSON events to events. Auto picks Tty if out is a terminal.
+func newReporter(mode string, out io.Writer, events io.Writer, terminal bool) (*Reporter, error) {
+	switch mode {
+	case "", Auto:
+		mode = Lines
+		if terminal {
+			mode = Tty
+		}
+	case Tty, Lines, Json, None:
+	default:
+		return nil, fmt.Errorf("invalid progress mode '%v', use one of: %v", mode, strings.Join(Modes, ", "))
+	}
+	return &Reporter{mode: mode, out: out, events: events}, nil
+}
+
+// Prints a message, above the bars in tty mode.
+func (r *Reporter) Printf(format string, args ...interface{}) {
+	if r == nil {
+		fmt.Printf(format, args...)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clear()
+	fmt.Fprintf(r.out, format, args...)
+	r.draw()
+}
+
+// Starts reporting a download of size bytes, or -1 if the size is unknown. Offset is the number
+// of bytes that were downloaded before, e.g. by an interrupted download that is resumed.
+func (r *Reporter) Start(name string, size int64, offset int64) *Transfer {
+	return r.start(download, name, size, offset)
+}
+
+// Starts reporting an upload of size bytes, or -1 if the size is unknown.
+func (r *Reporter) StartUpload(name string, size int64) *Transfer {
+	return r.start(upload, name, size, 0)
+}
+
+func (r *Reporter) start(direction string, name string, size int64, offset int64) *Transfer {
+	now := time.Now()
+	t := &Transfer{r: r, direction: direction, name: name, size: size, offset: offset, bytes: offset, started: now, reported: now}
+	if r == nil {
+		return t
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch r.mode {
+	case Tty:
+		r.active = append(r.active, t)
+		r.clear()
+		r.draw()
+	case Json:
+		r.emit(t, "start", nil)
+	}
+	return t
+}
+
+// Transfer is a single upload or download that is reported by a Reporter.
+type Transfer struct {
+	r *Reporter
+	// Either download or upload.
+	direction string
+	name      string
+	size      int64
+	offset    int64
+	// Bytes transferred so far, including the offset.
+	bytes    int64
+	started  time.Time
+	reported time.Time
+	finished bool
+}
+
+// Adds transferred bytes.
+func (t *Transfer) Add(n int64) {
+	if t.r == nil {
+		t.bytes += n
+		return
+	}
+	r := t.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	t.bytes += n
+	now := time.Now()
+	switch r.mode {
+	case Tty:
+		if now.Sub(r.lastDraw) >= ttyInterval {
+			r.clear()
+			r.draw()
+		}
+	case Lines:
+		if now.Sub(t.reported) >= linesInterval {
+			t.reported = now
+			fmt.Fprintf(r.out, "%v: %v\n", t.name, t.status(false))
+		}
+	case Json:
+		if now.Sub(t.reported) >= jsonInterval {
+			t.reported = now
+			r.emit(t, "progress", nil)
+		}
+	}
+}
+
+// Write counts the bytes written, so that a Transfer can be used with io.MultiWriter.
+func (t *Transfer) Write(p []byte) (int, error) {
+	t.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// Returns a reader that adds the bytes read from reader to the transfer.
+func (t *Transfer) Reader(reader io.Reader) io.Reader {
+	return io.TeeReader(reader, t)
+}
+
+// Returns the number of bytes transferred so far, including the offset.
+func (t *Transfer) Bytes() int64 {
+	if t.r != nil {
+		t.r.mu.Lock()
+		defer t.r.mu.Unlock()
+	}
+	return t.bytes
+}
+
+// Finishes a successful transfer, and prints its size, duration and throughput.
+func (t *Transfer) Done() {
+	t.finish(func(r *Reporter) {
+		elapsed := time.Since(t.started)
+		verb := "Downloaded"
+		if t.direction == upload {
+			verb = "Uploaded"
+		}
+		fmt.Fprintf(r.out, "%v: %v %v in %v (%v). Done!\n", t.name, verb, formatSize(t.bytes), elapsed.Round(time.Millisecond), formatRate(t.bytes-t.offset, elapsed))
+		if r.mode == Json {
+			r.emit(t, "done", nil)
+		}
+	})
+}
+
+// Finishes a failed transfer. The error itself is reported by the caller, except for a JSON event.
+func (t *Transfer) Fail(err error) {
+	t.finish(func(r *Reporter) {
+		if r.mode == Json {
+			r.emit(t, "error", err)
+		}
+	})
+}
+
+func (t *Transfer) finish(report func(r *Reporter)) {
+	r := t.r
+	if r == nil {
+		r = &Reporter{mode: None, out: os.Stdout}
+	} else {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+	}
+	if t.finished {
+		return
+	}
+	t.finished = true
+	r.clear()
+	for i, active := range r.active {
+		if active == t {
+			r.active = append(r.active[:i], r.active[i+1:]...)
+			break
+		}
+	}
+	report(r)
+	r.draw()
+}
+
+// Returns the bytes per second since the start, not counting the offset.
+func (t *Transfer) rate() float64 {
+	elapsed := time.Since(t.started).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(t.bytes-t.offset) / elapsed
+}
+
+// Returns the estimated time until the transfer is complete, or a negative duration if it is unknown.
+func (t *Transfer) eta() time.Duration {
+	rate := t.rate()
+	if t.size < 0 || rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(t.size-t.bytes) / rate * float64(time.Second))
+}
+
+// Describes the progress, with a bar for tty mode.
+func (t *Transfer) status(bar bool) string {
+	rate := formatSize(int64(t.rate())) + "/s"
+	if t.size < 0 {
+		return fmt.Sprintf("%v, %v", formatSize(t.bytes), rate)
+	}
+	percentage := int64(100)
+	if t.size > 0 {
+		percentage = 100 * t.bytes / t.size
+	}
+	eta := "-"
+	if d := t.eta(); d >= 0 {
+		eta = d.Round(time.Second).String()
+	}
+	if bar {
+		filled := int(percentage * barWidth / 100)
+		if filled > barWidth {
+			filled = barWidth
+		}
+		return fmt.Sprintf("[%v%v] %3v%% %v / %v, %v, ETA %v", strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled), percentage, formatSize(t.bytes), formatSize(t.size), rate, eta)
+	}
+	return fmt.Sprintf("%v%% of %v, %v, ETA %v", percentage, formatSize(t.size), rate, eta)
+}
+
+// Removes the bars from the screen. Must be called with the lock held.
+func (r *Reporter) clear() {
+	if r.drawn > 0 {
+		// Up to the first bar, and clear everything below.
+		fmt.Fprintf(r.out, "\033[%vA\033[J", r.drawn)
+		r.drawn = 0
+	}
+}
+
+// Draws a bar for each active transfer. Must be called with the lock held, after clear.
+func (r *Reporter) draw() {
+	if r.mode != Tty {
+		return
+	}
+	width := 80
+	if w, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && w > 0 {
+		width = w
+	}
+	for _, t := range r.active {
+		name := t.name
+		if len(name) > nameWidth {
+			name = "..." + name[len(name)-nameWidth+3:]
+		}
+		line := fmt.Sprintf("%-*v %v", nameWidth, name, t.status(true))
+		if len(line) >= width {
+			line = line[:width-1]
+		}
+		fmt.Fprintln(r.out, line)
+	}
+	r.drawn = len(r.active)
+	r.lastDraw = time.Now()
+}
+
+// A JSON event. Sizes are in bytes, -1 if unknown. Durations are in seconds.
+type event struct {
+	Event     string  `json:"event"`
+	Time      string  `json:"time"`
+	Direction string  `json:"direction"`
+	Name      string  `json:"name"`
+	Size      int64   `json:"size"`
+	Bytes     int64   `json:"bytes"`
+	Rate      float64 `json:"rate"`
+	Eta       float64 `json:"eta,omitempty"`
+	Elapsed   float64 `json:"elapsed"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Writes an event. Must be called with the lock held.
+func (r *Reporter) emit(t *Transfer, name string, err error) {
+	e := event{Event: name, Time: time.Now().UTC().Format(time.RFC3339Nano), Direction: t.direction, Name: t.name, Size: t.size, Bytes: t.bytes, Rate: t.rate(), Elapsed: time.Since(t.started).Seconds()}
+	if d := t.eta(); d >= 0 && name == "progress" {
+		e.Eta = d.Seconds()
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	data, _ := json.Marshal(e)
+	fmt.Fprintln(r.events, string(data))
+}
+
+// Formats a number of bytes for people, e.g. '12.3 MiB'.
+func formatSize(size int64) string {
+	if size < 1<<10 {
+		return fmt.Sprintf("%v B", size)
+	}
+	value := float64(size) / (1 << 10)
+	for _, unit := range []string{"KiB", "MiB", "GiB"} {
+		if value < 1<<10 || unit == "GiB" {
+			return fmt.Sprintf("%.1f %v", value, unit)
+		}
+		value /= 1 << 10
+	}
+	return ""
+}
+
+// Formats the throughput of a transfer, e.g. '4.5 MiB/s'.
+func formatRate(size int64, elapsed time.Duration) string {
+	if elapsed <= 0 {
+		return "-"
+	}
+	return formatSize(int64(float64(size)/elapsed.Seconds())) + "/s"
+}
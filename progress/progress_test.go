@@ -0,0 +1,246 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a reporter that writes into buffers.
+func newTestReporter(t *testing.T, mode string) (*Reporter, *bytes.Buffer, *bytes.Buffer) {
+	var out, events bytes.Buffer
+	r, err := newReporter(mode, &out, &events, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, &out, &events
+}
+
+// Makes the next Add of the transfer report its progress, as if a minute had passed.
+func elapse(transfer *Transfer) {
+	transfer.started = transfer.started.Add(-time.Minute)
+	transfer.reported = transfer.reported.Add(-time.Minute)
+	transfer.r.lastDraw = transfer.r.lastDraw.Add(-time.Minute)
+}
+
+func TestModes(t *testing.T) {
+	tests := []struct {
+		mode     string
+		terminal bool
+		want     string
+		wantErr  bool
+	}{
+		{"", true, Tty, false},
+		{"", false, Lines, false},
+		{Auto, true, Tty, false},
+		{Auto, false, Lines, false},
+		{Tty, false, Tty, false},
+		{Lines, true, Lines, false},
+		{Json, true, Json, false},
+		{None, true, None, false},
+		{"bars", true, "", true},
+	}
+	for _, test := range tests {
+		r, err := newReporter(test.mode, &bytes.Buffer{}, &bytes.Buffer{}, test.terminal)
+		if (err != nil) != test.wantErr {
+			t.Errorf("newReporter(%v) error = %v, wantErr %v", test.mode, err, test.wantErr)
+			continue
+		}
+		if err == nil && r.mode != test.want {
+			t.Errorf("newReporter(%v) on a terminal %v = %v, want %v", test.mode, test.terminal, r.mode, test.want)
+		}
+	}
+}
+
+func TestNilReporter(t *testing.T) {
+	var r *Reporter
+	transfer := r.Start("zap-linux-x64.zip", 1000, 100)
+	transfer.Add(200)
+	transfer.Write(make([]byte, 300))
+	if transfer.Bytes() != 600 {
+		t.Errorf("Bytes() = %v, want 600", transfer.Bytes())
+	}
+	transfer.Fail(errors.New("interrupted"))
+	transfer.Done()
+	r.StartUpload("zap-linux-x64.zip", -1).Done()
+}
+
+func TestLinesMode(t *testing.T) {
+	r, out, events := newTestReporter(t, Lines)
+	transfer := r.Start("zap-linux-x64.zip", 4<<20, 0)
+	transfer.Add(1 << 20)
+	if out.Len() != 0 {
+		t.Errorf("progress before the interval: %q", out.String())
+	}
+	elapse(transfer)
+	transfer.Add(1 << 20)
+	r.Printf("Verified %v.\n", "zap-linux-x64.zip")
+	transfer.Done()
+	transfer.Done()
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("output = %q, want 3 lines", out.String())
+	}
+	if !strings.HasPrefix(lines[0], "zap-linux-x64.zip: 50% of 4.0 MiB, ") {
+		t.Errorf("progress line = %q", lines[0])
+	}
+	if lines[1] != "Verified zap-linux-x64.zip." {
+		t.Errorf("message = %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "zap-linux-x64.zip: Downloaded 2.0 MiB in ") || !strings.HasSuffix(lines[2], "Done!") {
+		t.Errorf("done line = %q", lines[2])
+	}
+	if strings.Contains(out.String(), "\033") || events.Len() != 0 {
+		t.Errorf("lines mode wrote escape sequences or events: %q %q", out.String(), events.String())
+	}
+}
+
+func TestLinesModeUnknownSize(t *testing.T) {
+	r, out, _ := newTestReporter(t, Lines)
+	transfer := r.Start("zap-linux-x64.zip", -1, 0)
+	elapse(transfer)
+	transfer.Add(3 << 20)
+	if !strings.HasPrefix(out.String(), "zap-linux-x64.zip: 3.0 MiB, ") || strings.Contains(out.String(), "%") {
+		t.Errorf("progress line = %q", out.String())
+	}
+}
+
+func TestTtyMode(t *testing.T) {
+	r, out, events := newTestReporter(t, Tty)
+	first := r.Start("zap-linux-x64.zip", 1000, 0)
+	r.Start("zap-mac-x64.zip", 1000, 0)
+	out.Reset()
+	elapse(first)
+	first.Add(500)
+	// The two bars are cleared and drawn again.
+	bars := strings.Split(strings.TrimPrefix(out.String(), "\033[2A\033[J"), "\n")
+	if !strings.HasPrefix(out.String(), "\033[2A\033[J") || len(bars) != 3 {
+		t.Fatalf("redraw = %q", out.String())
+	}
+	if !strings.HasPrefix(bars[0], "zap-linux-x64.zip") || !strings.Contains(bars[0], "[########--------]  50%") {
+		t.Errorf("bar = %q", bars[0])
+	}
+	if !strings.HasPrefix(bars[1], "zap-mac-x64.zip") || !strings.Contains(bars[1], "[----------------]   0%") {
+		t.Errorf("bar = %q", bars[1])
+	}
+
+	// Messages go above the bars.
+	out.Reset()
+	r.Printf("Retrying\n")
+	if !strings.HasPrefix(out.String(), "\033[2A\033[JRetrying\nzap-linux-x64.zip") {
+		t.Errorf("message = %q", out.String())
+	}
+
+	// A finished transfer loses its bar.
+	out.Reset()
+	first.Done()
+	lines := strings.Split(strings.TrimPrefix(out.String(), "\033[2A\033[J"), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "Done!") || !strings.HasPrefix(lines[1], "zap-mac-x64.zip") {
+		t.Errorf("done = %q", out.String())
+	}
+	if events.Len() != 0 {
+		t.Errorf("tty mode wrote events: %q", events.String())
+	}
+}
+
+func TestJsonMode(t *testing.T) {
+	r, out, events := newTestReporter(t, Json)
+	download := r.Start("zap-linux-x64.zip", 1000, 200)
+	download.Add(300)
+	elapse(download)
+	download.Add(100)
+	download.Done()
+	upload := r.StartUpload("zap/v2024.04.15/zap-linux-x64.zip", -1)
+	elapse(upload)
+	upload.Add(100)
+	upload.Fail(errors.New("connection reset"))
+	upload.Fail(errors.New("reported once"))
+
+	// The fields that the README documents.
+	type event struct {
+		Event     string   `json:"event"`
+		Time      string   `json:"time"`
+		Direction string   `json:"direction"`
+		Name      string   `json:"name"`
+		Size      int64    `json:"size"`
+		Bytes     int64    `json:"bytes"`
+		Rate      *float64 `json:"rate"`
+		Eta       *float64 `json:"eta"`
+		Elapsed   *float64 `json:"elapsed"`
+		Error     string   `json:"error"`
+	}
+	want := []event{
+		{Event: "start", Direction: "download", Name: "zap-linux-x64.zip", Size: 1000, Bytes: 200},
+		{Event: "progress", Direction: "download", Name: "zap-linux-x64.zip", Size: 1000, Bytes: 600},
+		{Event: "done", Direction: "download", Name: "zap-linux-x64.zip", Size: 1000, Bytes: 600},
+		{Event: "start", Direction: "upload", Name: "zap/v2024.04.15/zap-linux-x64.zip", Size: -1, Bytes: 0},
+		{Event: "progress", Direction: "upload", Name: "zap/v2024.04.15/zap-linux-x64.zip", Size: -1, Bytes: 100},
+		{Event: "error", Direction: "upload", Name: "zap/v2024.04.15/zap-linux-x64.zip", Size: -1, Bytes: 100, Error: "connection reset"},
+	}
+	lines := strings.Split(strings.TrimSuffix(events.String(), "\n"), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("events = %q, want %v of them", events.String(), len(want))
+	}
+	for i, line := range lines {
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatalf("event %q: %v", line, err)
+		}
+		if _, err := time.Parse(time.RFC3339Nano, e.Time); err != nil {
+			t.Errorf("event %q has an invalid time: %v", line, err)
+		}
+		if e.Rate == nil || e.Elapsed == nil {
+			t.Errorf("event %q lacks rate or elapsed", line)
+		}
+		// Only progress events of transfers with a known size have an ETA.
+		if (e.Eta != nil) != (e.Event == "progress" && e.Size >= 0) {
+			t.Errorf("event %q has eta %v", line, e.Eta)
+		}
+		w := want[i]
+		if e.Event != w.Event || e.Direction != w.Direction || e.Name != w.Name || e.Size != w.Size || e.Bytes != w.Bytes || e.Error != w.Error {
+			t.Errorf("event %v = %q, want %+v", i, line, w)
+		}
+	}
+	// People still get the final line of each transfer.
+	if !strings.Contains(out.String(), "zap-linux-x64.zip: Downloaded ") || strings.Contains(out.String(), "{") {
+		t.Errorf("output = %q", out.String())
+	}
+}
+
+func TestNoneMode(t *testing.T) {
+	r, out, events := newTestReporter(t, None)
+	transfer := r.StartUpload("zap-linux-x64.zip", 1000)
+	elapse(transfer)
+	transfer.Add(1000)
+	transfer.Done()
+	if !strings.HasPrefix(out.String(), "zap-linux-x64.zip: Uploaded 1000 B in ") || strings.Count(out.String(), "\n") != 1 {
+		t.Errorf("output = %q, want only the done line", out.String())
+	}
+	if events.Len() != 0 {
+		t.Errorf("none mode wrote events: %q", events.String())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		0:         "0 B",
+		1023:      "1023 B",
+		1024:      "1.0 KiB",
+		1536:      "1.5 KiB",
+		5 << 20:   "5.0 MiB",
+		187432117: "178.7 MiB",
+		3 << 30:   "3.0 GiB",
+		5 << 40:   "5120.0 GiB",
+	}
+	for size, want := range tests {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%v) = %v, want %v", size, got, want)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package throttle
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Smallest amount of bytes that a transfer may read at once.
+const minBurst = 1 << 10
+
+// Limiter limits the rate of transfers, either each transfer on its own, or all of them together.
+// A nil Limiter doesn't limit anything.
+type Limiter struct {
+	// Bytes per second.
+	rate int64
+	// If not nil, the bucket that all transfers share.
+	shared *bucket
+	clock  *clock
+}
+
+// The time source of a limiter, which tests replace so that they don't depend on timing.
+type clock struct {
+	now func() time.Time
+	// Waits for the delay, or until ctx is done.
+	sleep func(ctx context.Context, delay time.Duration) error
+}
+
+var realClock = &clock{now: time.Now, sleep: sleep}
+
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Creates a limiter of rate bytes per second, or nil if the rate is 0. If shared is true, the rate is
+// the total of all transfers, e.g. of parallel downloads. Otherwise each transfer gets the full rate.
+func New(rate int64, shared bool) *Limiter {
+	return newLimiter(rate, shared, realClock)
+}
+
+func newLimiter(rate int64, shared bool, c *clock) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	l := &Limiter{rate: rate, clock: c}
+	if shared {
+		l.shared = newBucket(rate, c)
+	}
+	return l
+}
+
+// Returns a reader that reads from reader no faster than the rate. Waiting stops when ctx is done.
+func (l *Limiter) Reader(ctx context.Context, reader io.Reader) io.Reader {
+	if l == nil {
+		return reader
+	}
+	b := l.shared
+	if b == nil {
+		b = newBucket(l.rate, l.clock)
+	}
+	return &limitedReader{ctx: ctx, reader: reader, bucket: b}
+}
+
+// A token bucket that refills at the rate, and holds a tenth of a second of tokens.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	clock  *clock
+}
+
+func newBucket(rate int64, c *clock) *bucket {
+	burst := float64(rate) / 10
+	if burst < minBurst {
+		burst = minBurst
+	}
+	return &bucket{rate: float64(rate), burst: burst, tokens: burst, last: c.now(), clock: c}
+}
+
+// Takes n tokens, and waits until they would have been available. Readers that share the bucket
+// each wait for their own share, so that together they stay within the rate.
+func (b *bucket) take(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := b.clock.now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	return b.clock.sleep(ctx, delay)
+}
+
+type limitedReader struct {
+	ctx    context.Context
+	reader io.Reader
+	bucket *bucket
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// Reads are kept below the burst, so that the rate is smooth.
+	if len(p) > int(r.bucket.burst) {
+		p = p[:int(r.bucket.burst)]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.bucket.take(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
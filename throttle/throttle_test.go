@@ -0,0 +1,140 @@
+/*
+Copyright © 2024 Silicon Labs
+*/
+package throttle
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+// A clock that only advances when the limiter sleeps, and records the delays.
+type fakeClock struct {
+	clock
+	current time.Time
+	delays  []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	c := &fakeClock{current: time.Date(2024, 4, 2, 9, 15, 0, 0, time.UTC)}
+	c.now = func() time.Time { return c.current }
+	c.sleep = func(ctx context.Context, delay time.Duration) error {
+		c.delays = append(c.delays, delay)
+		c.current = c.current.Add(delay)
+		return ctx.Err()
+	}
+	return c
+}
+
+func (c *fakeClock) elapsed(start time.Time) time.Duration {
+	return c.current.Sub(start)
+}
+
+func TestBucket(t *testing.T) {
+	c := newFakeClock()
+	ctx := context.Background()
+	const rate = 100 << 10
+	b := newBucket(rate, &c.clock)
+	if b.burst != rate/10 {
+		t.Fatalf("burst = %v, want a tenth of the rate", b.burst)
+	}
+	steps := []struct {
+		name  string
+		idle  time.Duration
+		take  int
+		delay time.Duration
+	}{
+		{"burst", 0, 10 << 10, 0},
+		{"beyond the burst", 0, 10 << 10, 100 * time.Millisecond},
+		{"refilled while waiting", 0, 5 << 10, 50 * time.Millisecond},
+		{"refilled while idle", 50 * time.Millisecond, 5 << 10, 0},
+		{"idle longer than the burst", 10 * time.Second, 20 << 10, 100 * time.Millisecond},
+	}
+	for _, step := range steps {
+		c.current = c.current.Add(step.idle)
+		c.delays = nil
+		if err := b.take(ctx, step.take); err != nil {
+			t.Fatal(err)
+		}
+		var delay time.Duration
+		if len(c.delays) > 0 {
+			delay = c.delays[0]
+		}
+		if delay.Round(time.Microsecond) != step.delay {
+			t.Errorf("%v: take(%v) waited %v, want %v", step.name, step.take, delay, step.delay)
+		}
+	}
+	if b := newBucket(100, &c.clock); b.burst != minBurst {
+		t.Errorf("burst of a slow rate = %v, want %v", b.burst, minBurst)
+	}
+}
+
+// Reads size bytes through each of two readers of the limiter, taking turns, and returns how long it took.
+func transferTime(t *testing.T, l *Limiter, c *fakeClock, size int) time.Duration {
+	start := c.current
+	readers := []io.Reader{
+		l.Reader(context.Background(), bytes.NewReader(make([]byte, size))),
+		l.Reader(context.Background(), bytes.NewReader(make([]byte, size))),
+	}
+	buffer := make([]byte, 32<<10)
+	for done := 0; done < len(readers); {
+		done = 0
+		for _, reader := range readers {
+			if _, err := reader.Read(buffer); err == io.EOF {
+				done++
+			} else if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return c.elapsed(start)
+}
+
+func TestLimiter(t *testing.T) {
+	const rate = 100 << 10
+	tests := []struct {
+		name   string
+		shared bool
+		want   time.Duration
+	}{
+		// Each transfer starts with its own burst of a tenth of the rate, the rest takes 0.1s.
+		{"per transfer", false, 100 * time.Millisecond},
+		// Together, they share one burst, and the remaining 30 KiB take 0.3s.
+		{"shared", true, 300 * time.Millisecond},
+	}
+	for _, test := range tests {
+		c := newFakeClock()
+		l := newLimiter(rate, test.shared, &c.clock)
+		if d := transferTime(t, l, c, 20<<10); d.Round(time.Millisecond) != test.want {
+			t.Errorf("%v: two transfers of 20 KiB took %v, want %v", test.name, d, test.want)
+		}
+	}
+	if l := New(0, true); l != nil {
+		t.Errorf("New(0) = %v, want no limit", l)
+	}
+	var l *Limiter
+	if r := bytes.NewReader(nil); l.Reader(context.Background(), r) != r {
+		t.Error("a nil limiter wrapped the reader")
+	}
+}
+
+func TestLimiterCancel(t *testing.T) {
+	c := newFakeClock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	n, err := io.Copy(io.Discard, newLimiter(10<<10, true, &c.clock).Reader(ctx, bytes.NewReader(make([]byte, 10<<10))))
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("io.Copy() error = %v, want %v", err, context.Canceled)
+	}
+	// The burst is read, the first wait is canceled.
+	if n != 2<<10 {
+		t.Errorf("io.Copy() read %v bytes, want the burst and the read that waited", n)
+	}
+	if err := sleep(ctx, time.Hour); !errors.Is(err, context.Canceled) {
+		t.Errorf("sleep() error = %v, want %v", err, context.Canceled)
+	}
+}